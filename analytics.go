@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	analytics         = flag.Bool("analytics", false, "Count page views, unique visitors and referrers without cookies and show them at /_stats (requires authentication)")
+	analyticsFile     = flag.String("analytics-file", "", "Load analytics from `file` at startup and save them there as JSON every -analytics-interval and on shutdown")
+	analyticsInterval = flag.Duration("analytics-interval", 5*time.Minute, "Save analytics to -analytics-file every `duration`")
+)
+
+const (
+	analyticsDays    = 90
+	maxAnalyticsKeys = 1000
+)
+
+//go:embed analytics.html
+var analyticsHTML []byte
+
+type analyticsDay struct {
+	Date      string           `json:"date"`
+	Visitors  int64            `json:"visitors"`
+	PageViews int64            `json:"page_views"`
+	Pages     map[string]int64 `json:"pages"`
+	Referrers map[string]int64 `json:"referrers"`
+}
+
+type visitorKey [16]byte
+
+type siteStats struct {
+	mu   sync.Mutex
+	days []*analyticsDay
+	salt []byte
+	seen map[visitorKey]bool
+}
+
+var siteAnalytics = &siteStats{}
+
+func (s *siteStats) today(now time.Time) *analyticsDay {
+	date := now.Format(time.DateOnly)
+	if len(s.days) > 0 && s.days[len(s.days)-1].Date == date {
+		if s.salt == nil {
+			s.newSalt()
+		}
+		return s.days[len(s.days)-1]
+	}
+
+	day := &analyticsDay{Date: date, Pages: map[string]int64{}, Referrers: map[string]int64{}}
+	s.days = append(s.days, day)
+	if len(s.days) > analyticsDays {
+		s.days = s.days[len(s.days)-analyticsDays:]
+	}
+	s.newSalt()
+	return day
+}
+
+func (s *siteStats) newSalt() {
+	s.salt = make([]byte, 16)
+	rand.Read(s.salt)
+	s.seen = map[visitorKey]bool{}
+}
+
+func countKey(counts map[string]int64, key string) {
+	if _, ok := counts[key]; ok || len(counts) < maxAnalyticsKeys {
+		counts[key]++
+	}
+}
+
+func (s *siteStats) record(r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	day := s.today(time.Now())
+	day.PageViews++
+	countKey(day.Pages, r.URL.Path)
+
+	hash := sha256.New()
+	hash.Write(s.salt)
+	fmt.Fprintf(hash, "%s\x00%s", remoteIP(r), r.UserAgent())
+	var key visitorKey
+	copy(key[:], hash.Sum(nil))
+	if !s.seen[key] {
+		s.seen[key] = true
+		day.Visitors++
+	}
+
+	if referrer := referrerHost(r); referrer != "" {
+		countKey(day.Referrers, referrer)
+	}
+}
+
+func referrerHost(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Host == "" || strings.EqualFold(u.Host, r.Host) {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+func isBot(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	if userAgent == "" {
+		return true
+	}
+	for _, word := range []string{"bot", "crawl", "spider", "slurp", "preview", "curl", "wget", "python", "go-http-client"} {
+		if strings.Contains(userAgent, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPageView(r *http.Request, status int, header http.Header) bool {
+	if r.Method != http.MethodGet || (status != http.StatusOK && status != http.StatusNotModified) {
+		return false
+	}
+	if r.Header.Get("Purpose") == "prefetch" || r.Header.Get("Sec-Purpose") != "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType == "" && status == http.StatusNotModified {
+		if ext := path.Ext(r.URL.Path); ext == "" || ext == ".html" || ext == ".htm" {
+			mediaType = "text/html"
+		}
+	}
+	return mediaType == "text/html" && !isBot(r.UserAgent())
+}
+
+type pageCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+type analyticsSummary struct {
+	Days      int              `json:"days"`
+	Visitors  int64            `json:"visitors"`
+	PageViews int64            `json:"page_views"`
+	Pages     []pageCount      `json:"pages"`
+	Referrers []pageCount      `json:"referrers"`
+	Daily     []analyticsTally `json:"daily"`
+}
+
+type analyticsTally struct {
+	Date      string `json:"date"`
+	Visitors  int64  `json:"visitors"`
+	PageViews int64  `json:"page_views"`
+}
+
+func topCounts(counts map[string]int64, n int) []pageCount {
+	top := make([]pageCount, 0, len(counts))
+	for name, count := range counts {
+		top = append(top, pageCount{name, count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Name < top[j].Name
+	})
+	return top[:min(len(top), n)]
+}
+
+func (s *siteStats) summary(days int) analyticsSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := time.Now().AddDate(0, 0, 1-days).Format(time.DateOnly)
+	summary := analyticsSummary{Days: days, Daily: []analyticsTally{}}
+	pages, referrers := map[string]int64{}, map[string]int64{}
+
+	for _, day := range s.days {
+		if day.Date < since {
+			continue
+		}
+		summary.Visitors += day.Visitors
+		summary.PageViews += day.PageViews
+		summary.Daily = append(summary.Daily, analyticsTally{day.Date, day.Visitors, day.PageViews})
+		for name, n := range day.Pages {
+			pages[name] += n
+		}
+		for name, n := range day.Referrers {
+			referrers[name] += n
+		}
+	}
+
+	summary.Pages = topCounts(pages, 20)
+	summary.Referrers = topCounts(referrers, 20)
+	return summary
+}
+
+func (s *siteStats) load(name string) error {
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	days := []*analyticsDay{}
+	if err := json.Unmarshal(data, &days); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	for _, day := range days {
+		if day.Pages == nil {
+			day.Pages = map[string]int64{}
+		}
+		if day.Referrers == nil {
+			day.Referrers = map[string]int64{}
+		}
+	}
+
+	s.mu.Lock()
+	s.days = days[max(len(days)-analyticsDays, 0):]
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *siteStats) save(name string) error {
+	s.mu.Lock()
+	data, err := json.Marshal(s.days)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (s *siteStats) saveEvery(name string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.save(name); err != nil {
+			fmt.Fprintln(errorLog, "Error saving analytics:", err)
+		}
+	}
+}
+
+func withAnalytics(stats *siteStats, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lrw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(lrw, r)
+
+		if isPageView(r, lrw.status, lrw.Header()) {
+			stats.record(r)
+		}
+	}
+}
+
+func withAnalyticsPage(stats *siteStats, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_stats":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write(analyticsHTML)
+		case "/_stats/data":
+			days, err := strconv.Atoi(r.URL.Query().Get("days"))
+			if err != nil || days < 1 || days > analyticsDays {
+				days = 30
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			writeAPIJSON(w, http.StatusOK, stats.summary(days))
+		default:
+			h.ServeHTTP(w, r)
+		}
+	}
+}
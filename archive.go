@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+type archiveWriter interface {
+	addDir(name string, info os.FileInfo) error
+	addFile(name string, info os.FileInfo, r io.Reader) error
+	Close() error
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (a zipArchive) addDir(name string, info os.FileInfo) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name + "/"
+	_, err = a.CreateHeader(header)
+	return err
+}
+
+func (a zipArchive) addFile(name string, info os.FileInfo, r io.Reader) error {
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	w, err := a.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+type tarArchive struct {
+	*tar.Writer
+	gz *gzip.Writer
+}
+
+func newTarArchive(w io.Writer) archiveWriter {
+	gz := gzip.NewWriter(w)
+	return tarArchive{tar.NewWriter(gz), gz}
+}
+
+func (a tarArchive) addDir(name string, info os.FileInfo) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name + "/"
+	return a.WriteHeader(header)
+}
+
+func (a tarArchive) addFile(name string, info os.FileInfo, r io.Reader) error {
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := a.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.CopyN(a, r, header.Size)
+	return err
+}
+
+func (a tarArchive) Close() error {
+	if err := a.Writer.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+type archiveFormat struct {
+	contentType string
+	newWriter   func(w io.Writer) archiveWriter
+}
+
+var archiveFormats = map[string]archiveFormat{
+	"zip":    {"application/zip", func(w io.Writer) archiveWriter { return zipArchive{zip.NewWriter(w)} }},
+	"tar.gz": {"application/gzip", newTarArchive},
+}
+
+func writeArchive(fs fileSystem, a archiveWriter, dir, prefix string, skip func(urlPath string) bool) error {
+	d, err := fs.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	files, err := d.Readdir(-1)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range files {
+		if skip(dir + info.Name()) {
+			continue
+		}
+
+		name := path.Join(prefix, info.Name())
+		if info.IsDir() {
+			if err := a.addDir(name, info); err != nil {
+				return err
+			}
+			if err := writeArchive(fs, a, dir+info.Name()+"/", name, skip); err != nil {
+				return err
+			}
+			continue
+		}
+
+		file, err := fs.FileSystem.Open(dir + info.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := file.Stat()
+		if err != nil || !stat.Mode().IsRegular() {
+			file.Close()
+			continue
+		}
+		err = a.addFile(name, stat, file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func withArchives(fs fileSystem, scopes []authScope, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("download")
+		archive, ok := archiveFormats[format]
+		if !ok || !strings.HasSuffix(r.URL.Path, "/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		dir := path.Clean(r.URL.Path)
+		if dir != "/" {
+			dir += "/"
+		}
+
+		d, err := fs.Open(dir)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		stat, err := d.Stat()
+		d.Close()
+		if err != nil || !stat.IsDir() {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		name := path.Base(dir)
+		if name == "/" {
+			name = "root"
+		}
+		w.Header().Set("Content-Type", archive.contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		scope := scopeFor(scopes, path.Clean(dir))
+		skip := func(urlPath string) bool {
+			return scopeFor(scopes, urlPath) != scope
+		}
+
+		a := archive.newWriter(w)
+		if err := writeArchive(fs, a, dir, name, skip); err != nil {
+			fmt.Fprintln(errorLog, "Error writing archive:", err)
+		}
+		a.Close()
+	}
+}
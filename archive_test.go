@@ -0,0 +1,88 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestArchivesSkipProtectedSubtrees(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"public.txt", "private/secret.txt", "private/nested/deep.txt"} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := fileSystem{http.Dir(root), &settings{root: root, dirListings: true}}
+	scopes := []authScope{{"/private", func(string, string) bool { return true }}}
+	h := withArchives(fs, scopes, http.NotFoundHandler())
+
+	for _, format := range []string{"zip", "tar.gz"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?download="+format, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d", format, w.Code)
+		}
+
+		names := archiveNames(t, format, w.Body.Bytes())
+		if !slices.Contains(names, "root/public.txt") {
+			t.Errorf("%s: missing root/public.txt in %v", format, names)
+		}
+		for _, name := range names {
+			if name == "root/private/" || name == "root/private/secret.txt" || name == "root/private/nested/deep.txt" {
+				t.Errorf("%s: archive of / includes protected %s", format, name)
+			}
+		}
+
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/private/?download="+format, nil))
+		if names := archiveNames(t, format, w.Body.Bytes()); !slices.Contains(names, "private/nested/deep.txt") {
+			t.Errorf("%s: archive of /private/ is missing private/nested/deep.txt in %v", format, names)
+		}
+	}
+}
+
+func archiveNames(t *testing.T, format string, data []byte) []string {
+	t.Helper()
+	names := []string{}
+
+	if format == "zip" {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var auditLog = flag.String("audit-log", "", "Append a JSON line for every upload, WebDAV or -manage write to `file`")
+
+var readMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+}
+
+type auditEntry struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	IP          string    `json:"ip"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Destination string    `json:"destination,omitempty"`
+	Status      int       `json:"status"`
+	Bytes       int64     `json:"bytes"`
+}
+
+type auditLogger struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newAuditLogger(name string) (*auditLogger, error) {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLogger{file: file}, nil
+}
+
+func (l *auditLogger) write(entry auditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		fmt.Fprintln(errorLog, "Error writing audit log:", err)
+	}
+}
+
+func (l *auditLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func withAuditLog(l *auditLogger, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if readMethods[r.Method] {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		lrw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(lrw, r)
+
+		destination := r.Header.Get("Destination")
+		if destination == "" {
+			destination = r.URL.Query().Get("to")
+		}
+
+		l.write(auditEntry{
+			Time:        time.Now().UTC(),
+			User:        requestUser(r),
+			IP:          remoteIP(r),
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			Destination: destination,
+			Status:      lrw.status,
+			Bytes:       body.n,
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	basicAuth     = flag.String("auth", "", "Require HTTP Basic authentication with credentials in the form `user:pass`")
+	htpasswdFiles listFlag
+)
+
+func init() {
+	flag.Var(&htpasswdFiles, "htpasswd", "Require HTTP Basic authentication against a bcrypt or SHA htpasswd `file`, optionally scoped as /path=file (repeatable)")
+}
+
+type credentials struct {
+	user string
+	pass string
+}
+
+func parseCredentials(value string) (credentials, error) {
+	user, pass, ok := strings.Cut(value, ":")
+	if !ok || user == "" {
+		return credentials{}, errors.New("invalid credentials, expected user:pass")
+	}
+	return credentials{user, pass}, nil
+}
+
+func (c credentials) check(user, pass string) bool {
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(c.user)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(c.pass)) == 1
+	return userOK && passOK
+}
+
+type htpasswdEntry struct {
+	user string
+	hash string
+}
+
+func parseHtpasswd(name string) ([]htpasswdEntry, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := []htpasswdEntry{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid htpasswd line in %s", name)
+		}
+		if !strings.HasPrefix(hash, "$2") && !strings.HasPrefix(hash, "{SHA}") {
+			return nil, fmt.Errorf("unsupported hash for user %q in %s (use bcrypt or SHA)", user, name)
+		}
+
+		entries = append(entries, htpasswdEntry{user, hash})
+	}
+
+	return entries, scanner.Err()
+}
+
+func checkHtpasswd(entries []htpasswdEntry, user, pass string) bool {
+	for _, entry := range entries {
+		if entry.user != user {
+			continue
+		}
+
+		if sha, ok := strings.CutPrefix(entry.hash, "{SHA}"); ok {
+			sum := sha1.Sum([]byte(pass))
+			return subtle.ConstantTimeCompare([]byte(sha), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+		}
+		return bcrypt.CompareHashAndPassword([]byte(entry.hash), []byte(pass)) == nil
+	}
+	return false
+}
+
+type authScope struct {
+	prefix string
+	check  func(user, pass string) bool
+}
+
+func (s authScope) matches(urlPath string) bool {
+	return s.prefix == "/" || urlPath == s.prefix || strings.HasPrefix(urlPath, s.prefix+"/")
+}
+
+func scopesCover(scopes []authScope, urlPath string) bool {
+	for _, scope := range scopes {
+		if scope.matches(urlPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func scopeFor(scopes []authScope, urlPath string) string {
+	longest := ""
+	for _, scope := range scopes {
+		if scope.matches(urlPath) && len(scope.prefix) > len(longest) {
+			longest = scope.prefix
+		}
+	}
+	return longest
+}
+
+func parseAuthScopes() ([]authScope, error) {
+	scopes := []authScope{}
+
+	if *basicAuth != "" {
+		c, err := parseCredentials(*basicAuth)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, authScope{"/", c.check})
+	}
+
+	for _, value := range htpasswdFiles {
+		prefix, name := "/", value
+		if p, n, ok := strings.Cut(value, "="); ok && strings.HasPrefix(p, "/") {
+			prefix, name = path.Clean(p), n
+		}
+
+		if _, err := parseHtpasswd(name); err != nil {
+			return nil, err
+		}
+
+		file := &ruleFile[htpasswdEntry]{name: name, parse: parseHtpasswd}
+		scopes = append(scopes, authScope{prefix, func(user, pass string) bool {
+			return checkHtpasswd(file.load(), user, pass)
+		}})
+	}
+
+	return scopes, nil
+}
+
+func withBasicAuth(scopes []authScope, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		longest := scopeFor(scopes, path.Clean("/"+r.URL.Path))
+		if longest != "" {
+			user, pass, ok := r.BasicAuth()
+			authorized := false
+			for _, scope := range scopes {
+				if ok && scope.prefix == longest && scope.check(user, pass) {
+					authorized = true
+					break
+				}
+			}
+
+			if !authorized {
+				w.Header().Set("WWW-Authenticate", `Basic realm="serve", charset="UTF-8"`)
+				http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+				return
+			}
+			r = withCredential(withUser(r, user))
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
+
+type userKey struct{}
+
+func trackUser(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, new(string)))
+}
+
+func withUser(r *http.Request, user string) *http.Request {
+	if tracked, ok := r.Context().Value(userKey{}).(*string); ok {
+		*tracked = user
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), userKey{}, &user))
+}
+
+type credentialKey struct{}
+
+func withCredential(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), credentialKey{}, r.Header.Get("Authorization")))
+}
+
+func ownCredential(r *http.Request) bool {
+	credential, ok := r.Context().Value(credentialKey{}).(string)
+	return ok && credential == r.Header.Get("Authorization")
+}
+
+func requestUser(r *http.Request) string {
+	if user, ok := r.Context().Value(userKey{}).(*string); ok && *user != "" {
+		return *user
+	}
+	return "-"
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	bearerToken = flag.String("token", "", "Require an Authorization: Bearer header matching `token`")
+	jwksURL     = flag.String("jwks", "", "Require a Bearer JWT signed by a key from the JWKS at `url`")
+	jwtIssuer   = flag.String("jwt-issuer", "", "Require JWTs to be issued by `issuer`")
+	jwtAudience = flag.String("jwt-audience", "", "Require JWTs to be intended for `audience`")
+)
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	decode := func(s string) *big.Int {
+		b, _ := base64.RawURLEncoding.DecodeString(s)
+		return new(big.Int).SetBytes(b)
+	}
+
+	switch k.Kty {
+	case "RSA":
+		return &rsa.PublicKey{N: decode(k.N), E: int(decode(k.E).Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: decode(k.X), Y: decode(k.Y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+type jwksCache struct {
+	url string
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+func (c *jwksCache) fetch() error {
+	res, err := jwksClient.Get(c.url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s: %s", c.url, res.Status)
+	}
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := map[string]any{}
+	for _, k := range set.Keys {
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *jwksCache) key(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	c.mu.Lock()
+	key, ok := c.keys[kid]
+	stale := time.Since(c.fetchedAt) > time.Hour
+	refresh := (!ok || stale) && time.Since(c.fetchedAt) > time.Minute
+	if refresh {
+		c.fetchedAt = time.Now()
+	}
+	c.mu.Unlock()
+
+	if refresh {
+		if err := c.fetch(); err != nil {
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+		c.mu.Lock()
+		key, ok = c.keys[kid]
+		c.mu.Unlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+func newBearerCheck() (func(token string) bool, error) {
+	secret := *bearerToken
+	if *jwksURL == "" {
+		if *jwtIssuer != "" || *jwtAudience != "" {
+			return nil, errors.New("-jwt-issuer and -jwt-audience require -jwks")
+		}
+		return func(token string) bool {
+			return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+		}, nil
+	}
+
+	cache := &jwksCache{url: *jwksURL, fetchedAt: time.Now()}
+	if err := cache.fetch(); err != nil {
+		return nil, err
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if *jwtIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(*jwtIssuer))
+	}
+	if *jwtAudience != "" {
+		opts = append(opts, jwt.WithAudience(*jwtAudience))
+	}
+	parser := jwt.NewParser(opts...)
+
+	return func(token string) bool {
+		if secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1 {
+			return true
+		}
+		_, err := parser.Parse(token, cache.key)
+		return err == nil
+	}, nil
+}
+
+func withBearerAuth(check func(token string) bool, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || !check(strings.TrimSpace(token)) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="serve", error="invalid_token"`)
+			http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if claims, _, err := jwt.NewParser().ParseUnverified(strings.TrimSpace(token), jwt.MapClaims{}); err == nil {
+			if subject, err := claims.Claims.GetSubject(); err == nil {
+				r = withUser(r, subject)
+			}
+		}
+
+		h.ServeHTTP(w, withCredential(r))
+	}
+}
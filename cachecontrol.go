@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var cacheRules listFlag
+
+func init() {
+	flag.Var(&cacheRules, "cache", "Set Cache-Control for files matching a glob in the form `'pattern=value'` (repeatable)")
+}
+
+type cacheRule struct {
+	pattern string
+	value   string
+}
+
+func (rule cacheRule) match(urlPath string) bool {
+	name := path.Base(urlPath)
+	if strings.Contains(rule.pattern, "/") {
+		name = urlPath
+	}
+	ok, _ := path.Match(rule.pattern, name)
+	return ok
+}
+
+func parseCacheRules(rules []string) ([]cacheRule, error) {
+	parsed := []cacheRule{}
+	for _, rule := range rules {
+		pattern, value, ok := strings.Cut(rule, "=")
+		pattern, value = strings.TrimSpace(pattern), strings.TrimSpace(value)
+		if !ok || pattern == "" || value == "" {
+			return nil, fmt.Errorf("invalid cache rule %q", rule)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid cache rule %q: %w", rule, err)
+		}
+		parsed = append(parsed, cacheRule{pattern, value})
+	}
+	return parsed, nil
+}
+
+type cacheControlResponseWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (w *cacheControlResponseWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	cacheable := status == http.StatusOK || status == http.StatusPartialContent || status == http.StatusNotModified
+	if cacheable && w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", w.value)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheControlResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func withCacheControl(rules []cacheRule, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+		for _, rule := range rules {
+			if rule.match(urlPath) {
+				w = &cacheControlResponseWriter{ResponseWriter: w, value: rule.value}
+				break
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	chaosRate     = flag.Float64("chaos-rate", 10, "Inject the faults chosen with -chaos-* flags into `percent` of requests")
+	chaosLatency  = flag.Duration("chaos-latency", 0, "Delay some responses by a random time of up to `duration`")
+	chaosErrors   = flag.Bool("chaos-errors", false, "Fail some requests with 500 Internal Server Error")
+	chaosDrop     = flag.Bool("chaos-drop", false, "Close the connection on some requests without responding")
+	chaosTruncate = flag.Bool("chaos-truncate", false, "Cut off some response bodies partway through")
+)
+
+func chaosFaults() []string {
+	faults := []string{}
+	if *chaosLatency > 0 {
+		faults = append(faults, "latency")
+	}
+	if *chaosErrors {
+		faults = append(faults, "error")
+	}
+	if *chaosDrop {
+		faults = append(faults, "drop")
+	}
+	if *chaosTruncate {
+		faults = append(faults, "truncate")
+	}
+	return faults
+}
+
+type truncatedResponseWriter struct {
+	http.ResponseWriter
+	limit     int64
+	written   int64
+	truncated bool
+}
+
+func (w *truncatedResponseWriter) WriteHeader(status int) {
+	if w.limit < 0 {
+		size, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64)
+		if err != nil || size <= 0 {
+			size = 16 << 10
+		}
+		w.limit = rand.Int63n(size)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *truncatedResponseWriter) Write(p []byte) (int, error) {
+	if w.limit < 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.written+int64(len(p)) > w.limit {
+		w.truncated = true
+		n, _ := w.ResponseWriter.Write(p[:max(w.limit-w.written, 0)])
+		w.written += int64(n)
+		return len(p), nil
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *truncatedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func withChaos(rate float64, faults []string, h http.Handler) http.HandlerFunc {
+	latency := *chaosLatency
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rand.Float64()*100 >= rate {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		switch faults[rand.Intn(len(faults))] {
+		case "latency":
+			delay := time.Duration(rand.Int63n(int64(latency)))
+			debugf(r, "chaos: delaying the response by %s", delay.Round(time.Millisecond))
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+			h.ServeHTTP(w, r)
+		case "error":
+			debugf(r, "chaos: failing the request")
+			http.Error(w, "500 internal server error", http.StatusInternalServerError)
+		case "drop":
+			fmt.Fprintf(errorLog, "Chaos: dropped the connection for %s %s\n", r.Method, r.URL.Path)
+			panic(http.ErrAbortHandler)
+		case "truncate":
+			tw := &truncatedResponseWriter{ResponseWriter: w, limit: -1}
+			h.ServeHTTP(tw, r)
+			if !tw.truncated {
+				return
+			}
+			debugf(r, "chaos: truncated the response after %d bytes", tw.written)
+			if tw.Header().Get("Content-Length") == "" {
+				fmt.Fprintf(errorLog, "Chaos: truncated %s %s after %d bytes\n", r.Method, r.URL.Path, tw.written)
+				panic(http.ErrAbortHandler)
+			}
+		}
+	}
+}
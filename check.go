@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var (
+	checkConfig = flag.Bool("check", false, "Validate the settings from flags, environment variables and -config, then exit without serving")
+	printConfig = flag.Bool("print-config", false, "Print the effective settings and where each was set as JSON, then exit without serving")
+)
+
+var secretFlags = map[string]bool{
+	"auth":               true,
+	"token":              true,
+	"sign-key":           true,
+	"oidc-client-secret": true,
+}
+
+func checkSettings(root string) error {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !stat.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+
+	s := &site{settings: newSettings(root)}
+	_, err = newHandler(s)
+	s.close()
+	if err != nil {
+		return err
+	}
+
+	host, _, err := splitAddr(*addr)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := newTLSConfig(host)
+	if err != nil {
+		return err
+	}
+
+	if *redirectAddr != "" {
+		if tlsConfig == nil {
+			return errors.New("-redirect-http requires HTTPS to be enabled")
+		}
+		if _, _, err := splitAddr(*redirectAddr); err != nil {
+			return err
+		}
+	}
+
+	if *geoIPFile != "" {
+		db, err := openGeoIP(*geoIPFile)
+		if err != nil {
+			return err
+		}
+		db.Close()
+	}
+
+	if *debugAddr != "" {
+		if _, err := newDebugServer(*debugAddr); err != nil {
+			return err
+		}
+	}
+
+	if *maxHeaderBytes != "" {
+		if _, err := parseSize(*maxHeaderBytes); err != nil {
+			return err
+		}
+	}
+	for _, rate := range []string{*throttle, *connThrottle} {
+		if rate == "" {
+			continue
+		}
+		if _, err := parseRate(rate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type effectiveSetting struct {
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+}
+
+func writeSettings(w io.Writer, root string) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	settings := map[string]effectiveSetting{
+		"root": {abs, sourceOf("root")},
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name == "check" || f.Name == "print-config" {
+			return
+		}
+
+		var value any = f.Value.String()
+		if l, ok := f.Value.(interface{ values() []string }); ok {
+			value = append([]string{}, l.values()...)
+		} else if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			value, _ = strconv.ParseBool(f.Value.String())
+		} else if secretFlags[f.Name] && f.Value.String() != "" {
+			value = "[redacted]"
+		}
+		settings[f.Name] = effectiveSetting{value, sourceOf(f.Name)}
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(settings)
+}
+
+func sourceOf(name string) string {
+	if source, ok := settingSources[name]; ok {
+		return source
+	}
+	return "default"
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+var checksums = flag.Bool("checksums", false, "Serve file digests with ?hash=sha256 and a manifest of every file at /_manifest.json")
+
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+type digestEntry struct {
+	modTime time.Time
+	size    int64
+	digest  string
+}
+
+const digestCacheLimit = 4096
+
+type digestCache struct {
+	entries *lruCache[string, digestEntry]
+}
+
+func (c *digestCache) lookup(fs http.FileSystem, name, algorithm string) (string, int64, error) {
+	file, err := fs.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if stat.IsDir() {
+		return "", 0, fmt.Errorf("%s is a directory", name)
+	}
+
+	key := algorithm + ":" + name
+	entry, ok := c.entries.get(key)
+	if ok && entry.modTime.Equal(stat.ModTime()) && entry.size == stat.Size() {
+		return entry.digest, entry.size, nil
+	}
+
+	h := hashAlgorithms[algorithm]()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", 0, err
+	}
+
+	entry = digestEntry{modTime: stat.ModTime(), size: stat.Size(), digest: hex.EncodeToString(h.Sum(nil))}
+	c.entries.add(key, entry)
+	return entry.digest, entry.size, nil
+}
+
+type manifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Digest string `json:"digest"`
+}
+
+type manifest struct {
+	Algorithm string         `json:"algorithm"`
+	Files     []manifestFile `json:"files"`
+}
+
+func buildManifest(cfg *settings, scopes []authScope, cache *digestCache, algorithm string) (manifest, error) {
+	root := cfg.root
+	m := manifest{Algorithm: algorithm, Files: []manifestFile{}}
+	dir := http.Dir(root)
+	scope := scopeFor(scopes, "/_manifest.json")
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		urlPath := path.Clean("/" + filepath.ToSlash(rel))
+
+		if name != root && (cfg.isHiddenPath(urlPath) || scopeFor(scopes, urlPath) != scope) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		digest, size, err := cache.lookup(dir, urlPath, algorithm)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, manifestFile{urlPath, size, digest})
+		return nil
+	})
+	return m, err
+}
+
+func withChecksums(cfg *settings, scopes []authScope, fs http.FileSystem, h http.Handler) http.HandlerFunc {
+	cache := &digestCache{entries: newLRUCache[string, digestEntry](digestCacheLimit, nil)}
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/_manifest.json" && !query.Has("hash") {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		algorithm := query.Get("hash")
+		if algorithm == "" {
+			algorithm = "sha256"
+		}
+		if hashAlgorithms[algorithm] == nil {
+			http.Error(w, fmt.Sprintf("400 unsupported hash %q", algorithm), http.StatusBadRequest)
+			return
+		}
+
+		if r.URL.Path == "/_manifest.json" {
+			m, err := buildManifest(cfg, scopes, cache, algorithm)
+			if err != nil {
+				http.Error(w, "500 error building manifest", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			enc.Encode(m)
+			return
+		}
+
+		name := path.Clean("/" + r.URL.Path)
+		digest, _, err := cache.lookup(fs, name, algorithm)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "%s  %s\n", digest, path.Base(name))
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+var noColor = flag.Bool("no-color", false, "Disable colored output, which is also disabled by NO_COLOR or when output isn't a terminal")
+
+var useColor = false
+
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+func colorEnabled() bool {
+	return !*noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout) && enableVirtualTerminal(os.Stdout)
+}
+
+func paint(color bool, code, s string) string {
+	if !color {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
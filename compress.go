@@ -0,0 +1,247 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	noCompress  = flag.Bool("no-compress", false, "Disable compression of responses")
+	compressors = flag.String("compress", "zstd,br,gzip", "Compress responses using a comma-separated list of `encodings` in order of preference")
+	compressMin = flag.Int("compress-min", 1024, "Only compress responses of at least `bytes` when the size is known")
+	brotliLevel = flag.Int("brotli-quality", 5, "Set the Brotli compression `level` from 0 to 11")
+)
+
+var encoders = map[string]func(w io.Writer, brotliLevel int) io.WriteCloser{
+	"br":   func(w io.Writer, brotliLevel int) io.WriteCloser { return brotli.NewWriterLevel(w, brotliLevel) },
+	"gzip": func(w io.Writer, _ int) io.WriteCloser { return gzip.NewWriter(w) },
+	"zstd": func(w io.Writer, _ int) io.WriteCloser {
+		enc, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		return enc
+	},
+}
+
+func parseEncodings(list string) ([]string, error) {
+	encodings := []string{}
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+			continue
+		}
+		if _, ok := encoders[name]; !ok {
+			return nil, fmt.Errorf("unsupported encoding %q", name)
+		}
+		encodings = append(encodings, name)
+	}
+	return encodings, nil
+}
+
+var compressibleTypes = []string{
+	"text/",
+	"application/javascript",
+	"application/json",
+	"application/manifest+json",
+	"application/wasm",
+	"application/xml",
+	"image/svg+xml",
+	"image/x-icon",
+}
+
+func isCompressible(contentType string) bool {
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func addVary(h http.Header, name string) {
+	for _, value := range h.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
+
+func acceptedEncodings(r *http.Request, encodings []string) []string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		accepted[strings.ToLower(name)] = q > 0
+	}
+
+	matched := []string{}
+	for _, name := range encodings {
+		if accepted[name] {
+			matched = append(matched, name)
+		}
+	}
+	return matched
+}
+
+func negotiateEncoding(r *http.Request, encodings []string) string {
+	if matched := acceptedEncodings(r, encodings); len(matched) != 0 {
+		return matched[0]
+	}
+	return ""
+}
+
+type compressResponseWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	encoding    string
+	minSize     int
+	brotliLevel int
+	encoder     io.WriteCloser
+	wroteHeader bool
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader || status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if !isCompressible(h.Get("Content-Type")) || h.Get("Content-Encoding") != "" {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	addVary(h, "Accept-Encoding")
+
+	size, err := strconv.Atoi(h.Get("Content-Length"))
+	tooSmall := err == nil && size < w.minSize
+	if w.encoding == "" || tooSmall ||
+		status == http.StatusPartialContent || status == http.StatusNoContent || status == http.StatusNotModified {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", w.encoding)
+	weakenETag(h)
+	if w.r.Method != http.MethodHead {
+		w.encoder = encoders[w.encoding](w.ResponseWriter, w.brotliLevel)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressResponseWriter) FlushError() error {
+	if f, ok := w.encoder.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressResponseWriter) Close() error {
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return nil
+}
+
+func withCompression(cfg *settings, encodings []string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			r:              r,
+			encoding:       negotiateEncoding(r, encodings),
+			minSize:        cfg.compressMin,
+			brotliLevel:    cfg.brotliLevel,
+		}
+		defer cw.Close()
+
+		h.ServeHTTP(cw, r)
+	}
+}
+
+var sidecarExts = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+func withPrecompressed(fs http.FileSystem, encodings []string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accepted := acceptedEncodings(r, encodings)
+		if len(accepted) == 0 || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		name := path.Clean("/" + r.URL.Path)
+		file, err := fs.Open(name)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		stat, err := file.Stat()
+		file.Close()
+		if err != nil || stat.IsDir() {
+			h.ServeHTTP(w, r)
+			return
+		}
+		name = path.Join(path.Dir(name), stat.Name())
+
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		for _, encoding := range accepted {
+			sidecar, err := fs.Open(name + sidecarExts[encoding])
+			if err != nil {
+				continue
+			}
+			defer sidecar.Close()
+
+			sidecarStat, err := sidecar.Stat()
+			if err != nil || sidecarStat.IsDir() {
+				continue
+			}
+
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Encoding", encoding)
+			addVary(w.Header(), "Accept-Encoding")
+			http.ServeContent(w, r, name, sidecarStat.ModTime(), sidecar)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var configFile = flag.String("config", "", "Read flags from `file`, one 'name value' per line, reloading it on SIGHUP or change")
+
+type configSetting struct {
+	line  int
+	name  string
+	value string
+}
+
+func parseConfig(name string) ([]configSetting, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	settings := []configSetting{}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		key = strings.TrimLeft(key, "-")
+		value = strings.TrimSpace(value)
+
+		if key != "root" {
+			f := flag.Lookup(key)
+			if f == nil || key == "config" {
+				return nil, fmt.Errorf("%s:%d: unknown setting %q", name, n, key)
+			}
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && value == "" {
+				value = "true"
+			}
+		}
+
+		settings = append(settings, configSetting{n, key, value})
+	}
+
+	return settings, scanner.Err()
+}
+
+func resetFlags() {
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		if r, ok := f.Value.(interface{ reset() }); ok {
+			r.reset()
+			return
+		}
+		f.Value.Set(f.DefValue)
+	})
+}
+
+var envNames = map[string]string{
+	"l":    "SERVE_ADDR",
+	"a":    "SERVE_HIDDEN",
+	"d":    "SERVE_LISTINGS",
+	"q":    "SERVE_QUIET",
+	"s":    "",
+	"H":    "SERVE_HEADER",
+	"cert": "SERVE_TLS_CERT",
+	"key":  "SERVE_TLS_KEY",
+}
+
+func envName(flagName string) string {
+	if name, ok := envNames[flagName]; ok {
+		return name
+	}
+	return "SERVE_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+var settingSources map[string]string
+
+func loadSettings(args []string) (string, error) {
+	resetFlags()
+
+	root := "."
+	settingSources = map[string]string{}
+	if *configFile != "" {
+		settings, err := parseConfig(*configFile)
+		if err != nil {
+			return "", err
+		}
+		for _, s := range settings {
+			settingSources[s.name] = fmt.Sprintf("%s:%d", *configFile, s.line)
+			if s.name == "root" {
+				root = s.value
+				continue
+			}
+			if err := flag.Set(s.name, s.value); err != nil {
+				return "", fmt.Errorf("%s:%d: invalid value %q for %s: %v", *configFile, s.line, s.value, s.name, err)
+			}
+		}
+	}
+
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if name == "" || !ok || f.Name == "config" || err != nil {
+			return
+		}
+		if setErr := f.Value.Set(value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", value, name, setErr)
+		}
+		settingSources[f.Name] = "$" + name
+	})
+	if err != nil {
+		return "", err
+	}
+	if value, ok := os.LookupEnv("SERVE_ROOT"); ok {
+		root = value
+		settingSources["root"] = "$SERVE_ROOT"
+	}
+
+	before := map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		before[f.Name] = f.Value.String()
+	})
+	if err := flag.CommandLine.Parse(args); err != nil {
+		return "", err
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Value.String() != before[f.Name] {
+			settingSources[f.Name] = "flag"
+		}
+	})
+	if flag.NArg() != 0 {
+		root = flag.Arg(0)
+		settingSources["root"] = "flag"
+	}
+
+	return root, nil
+}
+
+type settings struct {
+	root            string
+	hiddenFiles     bool
+	dirListings     bool
+	cleanURLs       string
+	indexFiles      []string
+	upload          bool
+	overwrite       bool
+	listingPageSize int
+	quiet           bool
+	verbose         bool
+	compressMin     int
+	brotliLevel     int
+	configPath      string
+}
+
+func newSettings(root string) *settings {
+	s := &settings{
+		root:            root,
+		hiddenFiles:     *hiddenFiles,
+		dirListings:     *dirListings,
+		cleanURLs:       *cleanURLs,
+		upload:          *upload,
+		overwrite:       *overwrite,
+		listingPageSize: max(*listingPageSize, 0),
+		quiet:           *quiet,
+		verbose:         *verbose,
+		compressMin:     *compressMin,
+		brotliLevel:     *brotliLevel,
+	}
+	for _, name := range strings.Split(*indexFiles, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			s.indexFiles = append(s.indexFiles, name)
+		}
+	}
+	if *configFile != "" {
+		s.configPath = urlPathUnder(root, *configFile)
+	}
+	return s
+}
+
+func urlPathUnder(root, name string) string {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return ""
+	}
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(absRoot, absName)
+	if err != nil || !filepath.IsLocal(rel) {
+		return ""
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+type site struct {
+	settings *settings
+	handler  http.Handler
+	hub      *watchHub
+	closers  []io.Closer
+
+	active  atomic.Int64
+	retired atomic.Bool
+	closed  sync.Once
+}
+
+func newSite(root string) (*site, error) {
+	s := &site{settings: newSettings(root)}
+
+	hub, err := startWatching(s.settings)
+	if err != nil {
+		return nil, err
+	}
+	s.hub = hub
+
+	if s.handler, err = newHandler(s); err != nil {
+		s.retire()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *site) acquire() bool {
+	s.active.Add(1)
+	if s.retired.Load() {
+		s.release()
+		return false
+	}
+	return true
+}
+
+func (s *site) release() {
+	if s.active.Add(-1) == 0 && s.retired.Load() {
+		s.closed.Do(s.close)
+	}
+}
+
+func (s *site) retire() {
+	s.hub.close()
+	s.retired.Store(true)
+	if s.active.Load() == 0 {
+		s.closed.Do(s.close)
+	}
+}
+
+func (s *site) close() {
+	for _, c := range s.closers {
+		c.Close()
+	}
+}
+
+type siteHandler struct {
+	current atomic.Pointer[site]
+}
+
+func (s *siteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for {
+		current := s.current.Load()
+		if current.acquire() {
+			defer current.release()
+			current.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+}
+
+func (s *siteHandler) reload(args []string) error {
+	root, err := loadSettings(args)
+	if err != nil {
+		return err
+	}
+
+	next, err := newSite(root)
+	if err != nil {
+		return err
+	}
+
+	if old := s.current.Swap(next); old != nil {
+		old.retire()
+	}
+	return nil
+}
+
+func (s *siteHandler) watchConfig(args []string, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	modTime := time.Time{}
+	if stat, err := os.Stat(*configFile); err == nil {
+		modTime = stat.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-hup:
+		case <-ticker.C:
+			stat, err := os.Stat(*configFile)
+			if err != nil || stat.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = stat.ModTime()
+		}
+
+		if err := s.reload(args); err != nil {
+			fmt.Fprintln(errorLog, "Error reloading config:", err)
+		} else if !*quiet {
+			fmt.Fprintln(errorLog, "Reloaded", *configFile)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var (
+	cors            = flag.Bool("cors", false, "Allow cross-origin requests from any origin")
+	corsOrigins     listFlag
+	corsMethods     = flag.String("cors-methods", "GET, HEAD, OPTIONS", "Allow a comma-separated list of `methods` in cross-origin requests")
+	corsHeaders     = flag.String("cors-headers", "", "Allow a comma-separated list of request `headers` in cross-origin requests (default: any requested)")
+	corsExpose      = flag.String("cors-expose", "", "Expose a comma-separated list of response `headers` to cross-origin requests")
+	corsCredentials = flag.Bool("cors-credentials", false, "Allow cross-origin requests with credentials")
+	corsMaxAge      = flag.Int("cors-max-age", 86400, "Cache preflight responses for `seconds`")
+)
+
+func init() {
+	flag.Var(&corsOrigins, "cors-origin", "Allow cross-origin requests from `origin`, which may contain * wildcards (repeatable, implies -cors)")
+}
+
+type corsPolicy struct {
+	origins     []string
+	methods     string
+	headers     string
+	expose      string
+	credentials bool
+	maxAge      int
+}
+
+func newCORSPolicy() *corsPolicy {
+	origins := []string{}
+	for _, origin := range corsOrigins {
+		for _, o := range strings.Split(origin, ",") {
+			if o = strings.TrimSpace(o); o != "" {
+				origins = append(origins, strings.TrimSuffix(o, "/"))
+			}
+		}
+	}
+	if len(origins) == 0 {
+		origins = []string{"*"}
+	}
+
+	return &corsPolicy{
+		origins:     origins,
+		methods:     *corsMethods,
+		headers:     *corsHeaders,
+		expose:      *corsExpose,
+		credentials: *corsCredentials,
+		maxAge:      *corsMaxAge,
+	}
+}
+
+func (p *corsPolicy) allowOrigin(origin string) string {
+	for _, pattern := range p.origins {
+		if pattern == "*" && !p.credentials {
+			return "*"
+		}
+		if ok, _ := path.Match(pattern, origin); ok && origin != "" {
+			return origin
+		}
+	}
+	return ""
+}
+
+func withCORS(policy *corsPolicy, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := policy.allowOrigin(origin)
+		if allowed != "*" {
+			addVary(w.Header(), "Origin")
+		}
+
+		if allowed == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if policy.credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", policy.methods)
+			headers := policy.headers
+			if headers == "" {
+				headers = r.Header.Get("Access-Control-Request-Headers")
+			}
+			if headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(policy.maxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if policy.expose != "" {
+			w.Header().Set("Access-Control-Expose-Headers", policy.expose)
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const corsProxyPath = "/_proxy"
+
+var corsProxyHosts listFlag
+
+func init() {
+	flag.Var(&corsProxyHosts, "cors-proxy", "Fetch URLs on a comma-separated list of `hosts`, which may contain * wildcards, at /_proxy?url= and serve them with permissive CORS headers (repeatable)")
+}
+
+func allowedProxyURL(raw string, hosts []string) (*url.URL, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return u, true
+		}
+	}
+	return u, false
+}
+
+func newCORSProxy(hosts []string) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			target, _ := allowedProxyURL(pr.In.URL.Query().Get("url"), hosts)
+			pr.Out.URL = target
+			pr.Out.Host = ""
+			for _, name := range []string{"Authorization", "Proxy-Authorization", "Cookie", "Origin", "Referer"} {
+				pr.Out.Header.Del(name)
+			}
+		},
+		ModifyResponse: func(res *http.Response) error {
+			for name := range res.Header {
+				if strings.HasPrefix(name, "Access-Control-") {
+					res.Header.Del(name)
+				}
+			}
+			res.Header.Del("Set-Cookie")
+			res.Header.Set("Access-Control-Allow-Origin", "*")
+			res.Header.Set("Access-Control-Expose-Headers", "*")
+
+			if location, err := res.Location(); err == nil {
+				if _, ok := allowedProxyURL(location.String(), hosts); ok {
+					res.Header.Set("Location", corsProxyPath+"?url="+url.QueryEscape(location.String()))
+				}
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Fprintf(errorLog, "Error fetching %s: %v\n", r.URL.Query().Get("url"), err)
+			http.Error(w, "502 bad gateway", http.StatusBadGateway)
+		},
+	}
+}
+
+func withCORSProxy(hosts []string, h http.Handler) http.HandlerFunc {
+	proxy := newCORSProxy(hosts)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != corsProxyPath {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		for name := range w.Header() {
+			if strings.HasPrefix(name, "Access-Control-") {
+				w.Header().Del(name)
+			}
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		target, ok := allowedProxyURL(r.URL.Query().Get("url"), hosts)
+		if target == nil {
+			http.Error(w, "400 missing or invalid url parameter", http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			http.Error(w, "403 host not allowed by -cors-proxy", http.StatusForbidden)
+			return
+		}
+
+		debugf(r, "fetching %s for -cors-proxy", target)
+		proxy.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	debugMode = flag.Bool("debug", false, "Print the headers of each request and response along with the resolved file and how the request was handled")
+	debugBody = flag.Bool("debug-body", false, "Also print request bodies up to 64KB (implies -debug)")
+)
+
+const debugBodyLimit = 64 << 10
+
+func debugging() bool {
+	return *debugMode || *debugBody
+}
+
+type debugKey struct{}
+
+type debugTrace struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func debugf(r *http.Request, format string, args ...any) {
+	trace, ok := r.Context().Value(debugKey{}).(*debugTrace)
+	if !ok {
+		return
+	}
+
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	trace.steps = append(trace.steps, fmt.Sprintf(format, args...))
+}
+
+func resolveFile(cfg *settings, urlPath string) string {
+	name := path.Clean("/" + urlPath)
+	if cfg.isHiddenPath(name) {
+		return name + " is hidden (use -a to serve hidden files)"
+	}
+
+	file := filepath.Join(cfg.root, filepath.FromSlash(name))
+	stat, err := os.Stat(file)
+	if os.IsNotExist(err) && cfg.cleanURLs != "off" && path.Ext(name) == "" {
+		if _, err := os.Stat(file + ".html"); err == nil {
+			return "resolved to " + file + ".html (clean URL)"
+		}
+	}
+	if err != nil {
+		return err.Error()
+	}
+
+	if !stat.IsDir() {
+		return "resolved to " + file
+	}
+	for _, index := range cfg.indexFiles {
+		index = filepath.Join(file, index)
+		if _, err := os.Stat(index); err == nil {
+			return "resolved to " + index + " (index)"
+		}
+	}
+	if cfg.dirListings {
+		return "resolved to directory " + file + " without an index"
+	}
+	return "directory " + file + " has no index (use -d for listings)"
+}
+
+func withDebugFiles(cfg *settings, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		debugf(r, "%s", resolveFile(cfg, r.URL.Path))
+		h.ServeHTTP(w, r)
+	}
+}
+
+type bodyReader struct {
+	io.Reader
+	io.Closer
+}
+
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+func redactHeaders(header http.Header) http.Header {
+	header = header.Clone()
+	for _, name := range redactedHeaders {
+		if _, ok := header[name]; ok {
+			header[name] = []string{"[redacted]"}
+		}
+	}
+	return header
+}
+
+func writeDebugHeaders(out *strings.Builder, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(out, "  %s: %s\n", name, value)
+		}
+	}
+}
+
+func withDebug(withBody bool, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		trace := &debugTrace{}
+		r = r.WithContext(context.WithValue(r.Context(), debugKey{}, trace))
+
+		out := strings.Builder{}
+		dumped := r.WithContext(r.Context())
+		dumped.Header = redactHeaders(r.Header)
+		dump, _ := httputil.DumpRequest(dumped, false)
+		fmt.Fprintf(&out, "%s %s\n", paint(useColor, "36", "→"), strings.TrimRight(strings.ReplaceAll(string(dump), "\r\n", "\n  "), " \n"))
+
+		if withBody && r.Body != nil && r.Body != http.NoBody {
+			body, _ := io.ReadAll(io.LimitReader(r.Body, debugBodyLimit+1))
+			r.Body = bodyReader{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			if len(body) > debugBodyLimit {
+				fmt.Fprintf(&out, "\n%s\n  [truncated after %d bytes]\n", body[:debugBodyLimit], debugBodyLimit)
+			} else if len(body) > 0 {
+				fmt.Fprintf(&out, "\n%s\n", body)
+			}
+		}
+
+		lrw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(lrw, r)
+
+		trace.mu.Lock()
+		for _, step := range trace.steps {
+			fmt.Fprintf(&out, "  %s %s\n", paint(useColor, "90", "·"), step)
+		}
+		trace.mu.Unlock()
+
+		fmt.Fprintf(&out, "%s %d %s\n", paint(useColor, "36", "←"), lrw.status, http.StatusText(lrw.status))
+		writeDebugHeaders(&out, redactHeaders(lrw.Header()))
+		fmt.Fprintln(errorLog, out.String())
+	}
+}
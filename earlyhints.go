@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	preloadLinks    = flag.Bool("preload-links", false, "Add Link preload headers for stylesheets and scripts referenced by HTML pages")
+	preloadManifest = flag.String("preload-manifest", "", "Read Link preload assets from a JSON `file` mapping paths to asset lists instead of scanning HTML")
+	earlyHints      = flag.Bool("early-hints", false, "Send Link preload headers as 103 Early Hints before HTML pages")
+)
+
+type preloadRule struct {
+	pattern pathPattern
+	assets  []string
+}
+
+func parsePreloadManifest(name string) ([]preloadRule, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := map[string][]string{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	patterns := make([]string, 0, len(manifest))
+	for pattern := range manifest {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	rules := []preloadRule{}
+	for _, pattern := range patterns {
+		rules = append(rules, preloadRule{newPathPattern(pattern), manifest[pattern]})
+	}
+	return rules, nil
+}
+
+type scannedPage struct {
+	modTime time.Time
+	assets  []string
+}
+
+type pageScanner struct {
+	fs http.FileSystem
+
+	mu    sync.Mutex
+	pages map[string]scannedPage
+}
+
+func (s *pageScanner) assets(name string) []string {
+	file, err := s.fs.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() || path.Ext(stat.Name()) != ".html" {
+		return nil
+	}
+
+	s.mu.Lock()
+	page, ok := s.pages[name]
+	s.mu.Unlock()
+	if ok && page.modTime.Equal(stat.ModTime()) {
+		return page.assets
+	}
+
+	page = scannedPage{modTime: stat.ModTime()}
+	z := html.NewTokenizer(file)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		tag, hasAttr := z.TagName()
+		attrs := map[string]string{}
+		for hasAttr {
+			var key, value []byte
+			key, value, hasAttr = z.TagAttr()
+			attrs[string(key)] = string(value)
+		}
+
+		switch string(tag) {
+		case "link":
+			if strings.EqualFold(attrs["rel"], "stylesheet") && attrs["href"] != "" {
+				page.assets = append(page.assets, attrs["href"])
+			}
+		case "script":
+			if attrs["src"] != "" {
+				page.assets = append(page.assets, attrs["src"])
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.pages[name] = page
+	s.mu.Unlock()
+	return page.assets
+}
+
+func preloadLink(base, asset string) string {
+	if strings.HasPrefix(asset, "data:") || strings.HasPrefix(asset, "//") || strings.Contains(asset, "://") {
+		return ""
+	}
+	if !strings.HasPrefix(asset, "/") {
+		asset = path.Join(base, asset)
+	}
+
+	link := "<" + asset + ">; rel=preload"
+	switch path.Ext(strings.SplitN(asset, "?", 2)[0]) {
+	case ".css":
+		link += "; as=style"
+	case ".js", ".mjs":
+		link += "; as=script"
+	case ".woff", ".woff2":
+		link += "; as=font; crossorigin"
+	}
+	return link
+}
+
+func withPreloadLinks(scanner *pageScanner, manifest *ruleFile[preloadRule], h http.Handler) http.HandlerFunc {
+	hints := *earlyHints
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		urlPath := path.Clean("/" + r.URL.Path)
+		base, name := path.Dir(urlPath), urlPath
+		if strings.HasSuffix(r.URL.Path, "/") {
+			base, name = urlPath, strings.TrimSuffix(urlPath, "/")+"/index.html"
+		}
+
+		var assets []string
+		if manifest != nil {
+			for _, rule := range manifest.load() {
+				if _, ok := rule.pattern.match(urlPath); ok {
+					assets = append(assets, rule.assets...)
+				}
+			}
+		} else {
+			assets = scanner.assets(name)
+		}
+
+		for _, asset := range assets {
+			if link := preloadLink(base, asset); link != "" {
+				w.Header().Add("Link", link)
+			}
+		}
+
+		if hints && len(w.Header().Values("Link")) != 0 {
+			w.WriteHeader(http.StatusEarlyHints)
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	envSubst  = flag.Bool("env-subst", false, "Replace ${VAR} and ${VAR:-default} in HTML responses with environment variables")
+	envFile   = flag.String("env-file", "", "Read additional KEY=value variables for -env-subst from `file` (implies -env-subst)")
+	envPrefix = flag.String("env-prefix", "", "Only substitute environment variables whose names start with `prefix`, such as PUBLIC_")
+)
+
+var envReference = regexp.MustCompile(`\$\{([A-Z_][A-Z0-9_]*)(?::-([^}]*))?\}`)
+
+type envVar struct {
+	name  string
+	value string
+}
+
+func parseEnvFile(name string) ([]envVar, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	vars := []envVar{}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", name, n)
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		vars = append(vars, envVar{strings.TrimSpace(key), value})
+	}
+
+	return vars, scanner.Err()
+}
+
+func substituteEnv(data []byte, vars []envVar, prefix string) []byte {
+	return envReference.ReplaceAllFunc(data, func(ref []byte) []byte {
+		match := envReference.FindSubmatch(ref)
+		name := string(match[1])
+
+		for i := len(vars) - 1; i >= 0; i-- {
+			if vars[i].name == name {
+				return []byte(vars[i].value)
+			}
+		}
+		if value, ok := os.LookupEnv(name); ok && strings.HasPrefix(name, prefix) {
+			return []byte(value)
+		}
+		if strings.Contains(string(ref), ":-") {
+			return match[2]
+		}
+		return ref
+	})
+}
+
+func withEnvSubst(file *ruleFile[envVar], h http.Handler) http.HandlerFunc {
+	prefix := *envPrefix
+	return func(w http.ResponseWriter, r *http.Request) {
+		var vars []envVar
+		if file != nil {
+			vars = file.load()
+		}
+
+		hw := &htmlResponseWriter{ResponseWriter: w, r: r, dynamic: true, transform: func(data []byte) []byte {
+			return substituteEnv(data, vars, prefix)
+		}}
+
+		h.ServeHTTP(hw, uncachedHTMLRequest(r))
+		hw.finish()
+	}
+}
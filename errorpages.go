@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errorPages listFlag
+
+func init() {
+	flag.Var(&errorPages, "error", "Serve a custom error page for a status in the form `status=path` (repeatable)")
+}
+
+func parseErrorPages(pages []string) (map[int]string, error) {
+	parsed := map[int]string{}
+	for _, page := range pages {
+		status, path, ok := strings.Cut(page, "=")
+		code, err := strconv.Atoi(status)
+		if !ok || err != nil || code < 400 || code > 599 {
+			return nil, fmt.Errorf("invalid error page %q", page)
+		}
+		parsed[code] = "/" + strings.TrimPrefix(path, "/")
+	}
+	return parsed, nil
+}
+
+type errorPageResponseWriter struct {
+	http.ResponseWriter
+	r        *http.Request
+	fs       http.FileSystem
+	pages    map[int]string
+	nosniff  string
+	replaced bool
+}
+
+func (w *errorPageResponseWriter) WriteHeader(status int) {
+	page, ok := w.pages[status]
+	if !ok || w.replaced {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	file, err := w.fs.Open(page)
+	if err != nil {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	defer file.Close()
+
+	w.replaced = true
+
+	h := w.Header()
+	h.Del("Content-Length")
+	if w.nosniff != "" {
+		h.Set("X-Content-Type-Options", w.nosniff)
+	} else {
+		h.Del("X-Content-Type-Options")
+	}
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	w.ResponseWriter.WriteHeader(status)
+
+	if w.r.Method != http.MethodHead {
+		io.Copy(w.ResponseWriter, file)
+	}
+}
+
+func (w *errorPageResponseWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *errorPageResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func withErrorPages(fs http.FileSystem, pages map[int]string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&errorPageResponseWriter{ResponseWriter: w, r: r, fs: fs, pages: pages, nosniff: w.Header().Get("X-Content-Type-Options")}, r)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	etagHashLimit  = 8 << 20
+	etagCacheLimit = 4096
+)
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	tag     string
+}
+
+type etagCache struct {
+	entries *lruCache[string, etagEntry]
+}
+
+func (c *etagCache) lookup(fs http.FileSystem, name string) string {
+	file, err := fs.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return ""
+	}
+	if stat.IsDir() {
+		if !strings.HasSuffix(name, "/") {
+			return ""
+		}
+		return c.lookup(fs, name+"index.html")
+	}
+
+	if stat.Size() > etagHashLimit {
+		return `"` + strconv.FormatInt(stat.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(stat.Size(), 16) + `"`
+	}
+
+	entry, ok := c.entries.get(name)
+	if ok && entry.modTime.Equal(stat.ModTime()) && entry.size == stat.Size() {
+		return entry.tag
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return ""
+	}
+
+	entry = etagEntry{
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+		tag:     `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`,
+	}
+
+	c.entries.add(name, entry)
+	return entry.tag
+}
+
+func weakenETag(h http.Header) {
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		h.Set("ETag", "W/"+etag)
+	}
+}
+
+func withETags(fs http.FileSystem, h http.Handler) http.HandlerFunc {
+	cache := &etagCache{entries: newLRUCache[string, etagEntry](etagCacheLimit, nil)}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			name := path.Clean("/" + r.URL.Path)
+			if strings.HasSuffix(r.URL.Path, "/") && name != "/" {
+				name += "/"
+			}
+			if tag := cache.lookup(fs, name); tag != "" {
+				w.Header().Set("ETag", tag)
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var noFingerprint = flag.Bool("no-fingerprint", false, "Disable immutable caching and diagnostics for fingerprinted file names")
+
+var fingerprintPattern = regexp.MustCompile(`^(.+?)[.-]([0-9A-Za-z_]{6,64})(\.[0-9A-Za-z.]+)$`)
+
+func parseFingerprint(name string) (stem, hash, ext string, ok bool) {
+	m := fingerprintPattern.FindStringSubmatch(name)
+	if m == nil {
+		return "", "", "", false
+	}
+	stem, hash, ext = m[1], m[2], m[3]
+
+	hasDigit, hasLetter := false, false
+	for _, c := range hash {
+		if c >= '0' && c <= '9' {
+			hasDigit = true
+		} else if c != '_' {
+			hasLetter = true
+		}
+	}
+
+	if !hasDigit || !hasLetter || len(hash) < 8 {
+		return "", "", "", false
+	}
+	return stem, hash, ext, true
+}
+
+type fingerprintResponseWriter struct {
+	http.ResponseWriter
+	r        *http.Request
+	fs       http.FileSystem
+	replaced bool
+}
+
+func (w *fingerprintResponseWriter) WriteHeader(status int) {
+	switch status {
+	case http.StatusOK, http.StatusPartialContent, http.StatusNotModified:
+		if w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+	case http.StatusNotFound:
+		if !w.replaced {
+			w.replaced = true
+			h := w.Header()
+			h.Del("Content-Length")
+			h.Set("Content-Type", "text/plain; charset=utf-8")
+			h.Set("X-Content-Type-Options", "nosniff")
+			w.ResponseWriter.WriteHeader(status)
+			if w.r.Method != http.MethodHead {
+				fmt.Fprint(w.ResponseWriter, w.diagnostic())
+			}
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *fingerprintResponseWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *fingerprintResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *fingerprintResponseWriter) diagnostic() string {
+	urlPath := path.Clean("/" + w.r.URL.Path)
+	dir, name := path.Split(urlPath)
+	stem, hash, ext, _ := parseFingerprint(name)
+
+	out := strings.Builder{}
+	fmt.Fprintf(&out, "404 fingerprinted asset not found: %s\n\n", urlPath)
+
+	matches := []string{}
+	if file, err := w.fs.Open(dir); err == nil {
+		files, _ := file.Readdir(-1)
+		file.Close()
+		for _, f := range files {
+			s, h, e, ok := parseFingerprint(f.Name())
+			if ok && s == stem && e == ext && h != hash {
+				matches = append(matches, dir+f.Name())
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		fmt.Fprintf(&out, "No other versions of %s%s exist. The build output may be missing or out of date.\n", stem, ext)
+		return out.String()
+	}
+
+	fmt.Fprintf(&out, "Other versions of %s%s exist, so the page referencing this file may be stale:\n", stem, ext)
+	for _, match := range matches {
+		fmt.Fprintf(&out, "  %s\n", match)
+	}
+	return out.String()
+}
+
+func withFingerprints(fs http.FileSystem, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, _, _, ok := parseFingerprint(path.Base(r.URL.Path)); ok {
+			w = &fingerprintResponseWriter{ResponseWriter: w, r: r, fs: fs}
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
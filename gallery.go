@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+var gallery = flag.Bool("gallery", false, "Show images in directory listings as a thumbnail grid with a lightbox viewer")
+
+const (
+	thumbnailSize      = 320
+	thumbnailCacheSize = 1000
+	thumbnailMaxPixels = 64 << 20
+)
+
+var thumbnailExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+}
+
+type thumbnail struct {
+	modTime time.Time
+	data    []byte
+}
+
+type thumbnailCache struct {
+	mu      sync.Mutex
+	entries map[string]thumbnail
+}
+
+func (c *thumbnailCache) get(fs http.FileSystem, name string) ([]byte, time.Time, error) {
+	file, err := fs.Open(name)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	c.mu.Lock()
+	cached, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && cached.modTime.Equal(stat.ModTime()) {
+		return cached.data, cached.modTime, nil
+	}
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if int64(config.Width)*int64(config.Height) > thumbnailMaxPixels {
+		return nil, time.Time{}, fmt.Errorf("%s is too large to thumbnail", name)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	bounds := src.Bounds()
+	scale := float64(thumbnailSize) / float64(max(bounds.Dx(), bounds.Dy()))
+	if scale > 1 {
+		scale = 1
+	}
+	width := max(int(float64(bounds.Dx())*scale), 1)
+	height := max(int(float64(bounds.Dy())*scale), 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	buf := bytes.Buffer{}
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= thumbnailCacheSize {
+		c.entries = map[string]thumbnail{}
+	}
+	c.entries[name] = thumbnail{stat.ModTime(), buf.Bytes()}
+	c.mu.Unlock()
+
+	return buf.Bytes(), stat.ModTime(), nil
+}
+
+func isImage(name string) bool {
+	return thumbnailExts[strings.ToLower(path.Ext(name))]
+}
+
+func withThumbnails(fs http.FileSystem, h http.Handler) http.HandlerFunc {
+	cache := &thumbnailCache{entries: map[string]thumbnail{}}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.Query().Has("thumb") || !isImage(r.URL.Path) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		data, modTime, err := cache.get(fs, path.Clean("/"+r.URL.Path))
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/jpeg")
+		http.ServeContent(w, r, "", modTime, bytes.NewReader(data))
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+var geoIPFile = flag.String("geoip", "", "Add client countries and cities from the MaxMind GeoIP2 or GeoLite2 database at `file` to access logs and the traffic summary")
+
+var geoDB *geoip2.Reader
+
+type location struct {
+	country string
+	city    string
+}
+
+func openGeoIP(name string) (*geoip2.Reader, error) {
+	db, err := geoip2.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("opening GeoIP database: %w", err)
+	}
+	return db, nil
+}
+
+func lookupLocation(r *http.Request) location {
+	if geoDB == nil {
+		return location{}
+	}
+	ip := net.ParseIP(remoteIP(r))
+	if ip == nil {
+		return location{}
+	}
+
+	if strings.Contains(geoDB.Metadata().DatabaseType, "City") {
+		record, err := geoDB.City(ip)
+		if err != nil {
+			return location{}
+		}
+		return location{record.Country.IsoCode, record.City.Names["en"]}
+	}
+
+	record, err := geoDB.Country(ip)
+	if err != nil {
+		return location{}
+	}
+	return location{country: record.Country.IsoCode}
+}
+
+func (l location) String() string {
+	if l.city != "" {
+		return l.city + ", " + l.country
+	}
+	return l.country
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	customHeaders listFlag
+	headersFile   = flag.String("headers", "", "Apply header rules for path globs from `file`, in the same format as _headers")
+)
+
+func init() {
+	flag.Var(&customHeaders, "H", "Add a response header in the form `'Name: value'` to every response (repeatable)")
+}
+
+func parseCustomHeaders(headers []string) (http.Header, error) {
+	parsed := http.Header{}
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid header %q", header)
+		}
+		parsed.Add(name, strings.TrimSpace(value))
+	}
+	return parsed, nil
+}
+
+func withHeaders(headers http.Header, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for name, values := range headers {
+			w.Header()[name] = values
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
+
+type headerRule struct {
+	pattern pathPattern
+	headers http.Header
+}
+
+func parseHeaders(name string) ([]headerRule, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := []headerRule{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			rules = append(rules, headerRule{newPathPattern(trimmed), http.Header{}})
+			continue
+		}
+
+		name, value, ok := strings.Cut(trimmed, ":")
+		if ok && len(rules) != 0 {
+			rules[len(rules)-1].headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+
+	return rules, scanner.Err()
+}
+
+func withHeaderRules(headers *ruleFile[headerRule], h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+		if urlPath == "/_headers" {
+			http.NotFound(w, r)
+			return
+		}
+
+		for _, rule := range headers.load() {
+			if _, ok := rule.pattern.match(urlPath); ok {
+				for name, values := range rule.headers {
+					for _, value := range values {
+						w.Header().Add(name, value)
+					}
+				}
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+	"os"
+)
+
+var (
+	healthChecks = flag.Bool("health", false, "Answer liveness and readiness probes with JSON at -health-path and -ready-path, without logging them")
+	healthPath   = flag.String("health-path", "/_healthz", "Serve the liveness probe at `path` (requires -health)")
+	readyPath    = flag.String("ready-path", "/_readyz", "Serve the readiness probe at `path`, which fails while the root is unreadable (requires -health)")
+)
+
+func withHealthChecks(sites *siteHandler, h http.Handler) http.HandlerFunc {
+	live, ready := *healthPath, *readyPath
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case live:
+			w.Header().Set("Cache-Control", "no-store")
+			writeAPIJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		case ready:
+			status, root := http.StatusOK, "ok"
+			if stat, err := os.Stat(sites.current.Load().settings.root); err != nil {
+				status, root = http.StatusServiceUnavailable, err.Error()
+			} else if !stat.IsDir() {
+				status, root = http.StatusServiceUnavailable, "not a directory"
+			}
+
+			result := "ok"
+			if status != http.StatusOK {
+				result = "unavailable"
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			writeAPIJSON(w, status, map[string]any{
+				"status": result,
+				"checks": map[string]string{"root": root},
+			})
+		default:
+			h.ServeHTTP(w, r)
+		}
+	}
+}
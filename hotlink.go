@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+var (
+	hotlink            = flag.Bool("hotlink", false, "Block images, audio and video requested from pages on other hosts")
+	hotlinkAllow       listFlag
+	hotlinkPlaceholder = flag.String("hotlink-placeholder", "", "Serve the file at `path` instead of 403 for blocked hotlinks")
+)
+
+func init() {
+	flag.Var(&hotlinkAllow, "hotlink-allow", "Allow hotlinks from a comma-separated list of `hosts`, which may contain * wildcards (repeatable, implies -hotlink)")
+}
+
+func parseHotlinkHosts(values []string) []string {
+	hosts := []string{}
+	for _, value := range values {
+		for _, host := range strings.Split(value, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				hosts = append(hosts, strings.ToLower(host))
+			}
+		}
+	}
+	return hosts
+}
+
+func isMedia(urlPath string) bool {
+	contentType := mime.TypeByExtension(path.Ext(urlPath))
+	return strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/") || strings.HasPrefix(contentType, "audio/")
+}
+
+func allowedReferer(r *http.Request, hosts []string) bool {
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		return true
+	}
+
+	u, err := url.Parse(referer)
+	if err != nil {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func withHotlinkProtection(fs http.FileSystem, hosts []string, placeholder string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isMedia(r.URL.Path) || allowedReferer(r, hosts) || path.Clean("/"+r.URL.Path) == placeholder {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if placeholder != "" {
+			if file, err := fs.Open(placeholder); err == nil {
+				defer file.Close()
+				if stat, err := file.Stat(); err == nil && !stat.IsDir() {
+					w.Header().Set("Cache-Control", "no-store")
+					http.ServeContent(w, r, stat.Name(), stat.ModTime(), file)
+					return
+				}
+			}
+		}
+
+		http.Error(w, "403 hotlinking not allowed", http.StatusForbidden)
+	}
+}
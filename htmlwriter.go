@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type htmlResponseWriter struct {
+	http.ResponseWriter
+	r         *http.Request
+	status    int
+	buf       *bytes.Buffer
+	transform func(data []byte) []byte
+	dynamic   bool
+}
+
+func (w *htmlResponseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+
+	h := w.Header()
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if status != http.StatusOK || mediaType != "text/html" || h.Get("Content-Encoding") != "" {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.buf = &bytes.Buffer{}
+}
+
+func (w *htmlResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buf != nil {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *htmlResponseWriter) finish() {
+	if w.buf == nil {
+		return
+	}
+
+	h := w.Header()
+	weakenETag(h)
+	if w.dynamic {
+		h.Del("ETag")
+		h.Del("Last-Modified")
+		h.Del("Accept-Ranges")
+	}
+	if w.r.Method == http.MethodHead {
+		h.Del("Content-Length")
+		w.ResponseWriter.WriteHeader(w.status)
+		return
+	}
+
+	data := w.transform(w.buf.Bytes())
+
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(data)
+}
+
+func uncachedHTMLRequest(r *http.Request) *http.Request {
+	if ext := path.Ext(r.URL.Path); ext != "" && !strings.HasPrefix(mime.TypeByExtension(ext), "text/html") {
+		return r
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Del("If-Modified-Since")
+	r.Header.Del("If-None-Match")
+	r.Header.Del("Range")
+	return r
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"net/http"
+)
+
+var (
+	serverName   = flag.String("server", "", "Set the Server response header to `name`")
+	hideIdentity = flag.Bool("hide-identity", false, "Strip Server and X-Powered-By headers and suppress default error message bodies")
+)
+
+type identityResponseWriter struct {
+	http.ResponseWriter
+	server      string
+	hide        bool
+	wroteHeader bool
+	suppressed  bool
+}
+
+func (w *identityResponseWriter) WriteHeader(status int) {
+	h := w.Header()
+	if w.hide {
+		h.Del("Server")
+		h.Del("X-Powered-By")
+	}
+	if w.server != "" {
+		h.Set("Server", w.server)
+	}
+
+	if status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.wroteHeader = true
+
+	isDefaultError := h.Get("Content-Type") == "text/plain; charset=utf-8" && h.Get("X-Content-Type-Options") == "nosniff"
+	if w.hide && status >= http.StatusBadRequest && isDefaultError {
+		w.suppressed = true
+		h.Del("Content-Type")
+		h.Set("Content-Length", "0")
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *identityResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.suppressed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *identityResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func withIdentity(server string, hide bool, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(&identityResponseWriter{ResponseWriter: w, server: server, hide: hide}, r)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+type ignorePattern struct {
+	segments []string
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+type ignoreRules []ignorePattern
+
+func parseIgnorePatterns(patterns []string) ignoreRules {
+	rules := ignoreRules{}
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		rule := ignorePattern{}
+		if strings.HasPrefix(p, "!") {
+			rule.negate = true
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			rule.dirOnly = true
+			p = strings.TrimSuffix(p, "/")
+		}
+		rule.anchored = strings.Contains(p, "/")
+		rule.segments = strings.Split(strings.TrimPrefix(p, "/"), "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
+
+func (p ignorePattern) matches(segments []string, isDir bool) bool {
+	for i := range segments {
+		prefix := segments[:i+1]
+		prefixIsDir := isDir || i < len(segments)-1
+		if p.dirOnly && !prefixIsDir {
+			continue
+		}
+
+		if p.anchored {
+			if matchSegments(p.segments, prefix) {
+				return true
+			}
+		} else if ok, _ := path.Match(p.segments[0], prefix[i]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (rules ignoreRules) ignored(urlPath string, isDir bool) bool {
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+	ignored := false
+	for _, rule := range rules {
+		if rule.matches(segments, isDir) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
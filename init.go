@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+type prompter struct {
+	in *bufio.Reader
+}
+
+func (p prompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+
+	line, err := p.in.ReadString('\n')
+	if err == io.EOF && line == "" {
+		fmt.Println()
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def
+	}
+	return line
+}
+
+func (p prompter) confirm(question string) bool {
+	answer := strings.ToLower(p.ask(question+" (y/N)", ""))
+	return answer == "y" || answer == "yes"
+}
+
+func promptSettings() string {
+	p := prompter{bufio.NewReader(os.Stdin)}
+
+	root := p.ask("Directory to serve", ".")
+	flag.Set("l", p.ask("Address to listen on", *addr))
+	if p.confirm("Enable directory listings?") {
+		flag.Set("d", "true")
+	}
+	if p.confirm("Serve index.html for unknown paths (single-page app)?") {
+		flag.Set("s", "true")
+	}
+	if p.confirm("Serve over HTTPS with a self-signed certificate?") {
+		flag.Set("tls", "true")
+	}
+	if credentials := p.ask("Require a login in the form user:pass (empty for none)", ""); credentials != "" {
+		flag.Set("auth", credentials)
+	}
+
+	return root
+}
+
+func writeConfig(w io.Writer, root string) {
+	fmt.Fprintln(w, "# serve configuration, generated by serve init")
+	fmt.Fprintln(w, "#")
+	fmt.Fprintln(w, "# One setting per line in the form 'name value', using the flag names from serve -h.")
+	fmt.Fprintln(w, "# Boolean flags may omit the value and repeatable flags may appear more than once.")
+	fmt.Fprintln(w, "# The file is reloaded when it changes or on SIGHUP; command-line flags take precedence.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "# Serve files from this directory")
+	fmt.Fprintln(w, "root", root)
+
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+		if f.Name == "config" {
+			return
+		}
+
+		values := []string{f.Value.String()}
+		if l, ok := f.Value.(interface{ values() []string }); ok {
+			values = l.values()
+		}
+
+		_, usage := flag.UnquoteUsage(f)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "#", strings.ReplaceAll(usage, "`", ""))
+		for _, value := range values {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && value == "true" {
+				value = ""
+			}
+			fmt.Fprintln(w, strings.TrimSpace(f.Name+" "+value))
+		}
+	})
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "# Other settings, shown with their defaults. Uncomment a line to change it.")
+	flag.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] || f.Name == "config" {
+			return
+		}
+
+		name, usage := flag.UnquoteUsage(f)
+		value := f.DefValue
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			value = ""
+		} else if value == "" {
+			value = "<" + name + ">"
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "#", strings.ReplaceAll(usage, "`", ""))
+		fmt.Fprintln(w, "#", strings.TrimSpace(f.Name+" "+value))
+	})
+}
+
+func writeSystemdUnit(w io.Writer, config string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "[Unit]")
+	fmt.Fprintln(w, "Description=serve static file server")
+	fmt.Fprintln(w, "After=network-online.target")
+	fmt.Fprintln(w, "Wants=network-online.target")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "[Service]")
+	fmt.Fprintf(w, "ExecStart=%s -q -config %s\n", exe, config)
+	fmt.Fprintln(w, "ExecReload=/bin/kill -HUP $MAINPID")
+	fmt.Fprintln(w, "Restart=on-failure")
+	fmt.Fprintln(w, "NoNewPrivileges=true")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "[Install]")
+	fmt.Fprintln(w, "WantedBy=multi-user.target")
+	return nil
+}
+
+func createFile(name string, perm os.FileMode, force bool, write func(io.Writer) error) error {
+	mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		mode |= os.O_EXCL
+	}
+
+	file, err := os.OpenFile(name, mode, perm)
+	if errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("%s already exists (use -force to overwrite)", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func runInit(args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	output := flags.String("o", "serve.conf", "Write the config to `file`")
+	unit := flags.String("systemd", "", "Also write a systemd unit that runs serve with the config to `file`, such as serve.service")
+	force := flags.Bool("force", false, "Overwrite existing files")
+	yes := flags.Bool("y", false, "Accept the defaults instead of prompting")
+
+	flags.Usage = func() {
+		out := strings.Builder{}
+		out.WriteString("\nUsage:\n  serve init [flags] [-- flags] [root]\n\n")
+		out.WriteString("Prompts for common settings, or uses the serve flags and root given after --.\n\nFlags:\n")
+
+		tw := tabwriter.NewWriter(&out, 0, 0, 4, ' ', 0)
+		flags.VisitAll(func(f *flag.Flag) {
+			fmt.Fprintf(tw, "  -%s\t%s\n", f.Name, f.Usage)
+		})
+		tw.Flush()
+
+		fmt.Println(out.String())
+	}
+
+	flags.Parse(args)
+
+	root := "."
+	if flags.NArg() > 0 {
+		if err := flag.CommandLine.Parse(flags.Args()); err != nil {
+			return err
+		}
+		if flag.NArg() > 1 {
+			flags.Usage()
+			os.Exit(2)
+		}
+		if flag.NArg() == 1 {
+			root = flag.Arg(0)
+		}
+	} else if !*yes {
+		root = promptSettings()
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	config, err := filepath.Abs(*output)
+	if err != nil {
+		return err
+	}
+
+	err = createFile(*output, 0o600, *force, func(w io.Writer) error {
+		writeConfig(w, root)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Println("Wrote", *output)
+	if urlPathUnder(root, config) != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s is inside the root %s and is only hidden from clients while serve runs with -config %s\n", *output, root, *output)
+	}
+
+	if *unit != "" {
+		err := createFile(*unit, 0o644, *force, func(w io.Writer) error {
+			return writeSystemdUnit(w, config)
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Println("Wrote", *unit)
+	}
+
+	return nil
+}
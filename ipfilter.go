@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type ipRule struct {
+	allow  bool
+	prefix netip.Prefix
+}
+
+type ipRuleFlag struct {
+	rules *[]ipRule
+	allow bool
+}
+
+func (f ipRuleFlag) String() string {
+	if f.rules == nil {
+		return ""
+	}
+	values := []string{}
+	for _, rule := range *f.rules {
+		if rule.allow == f.allow {
+			values = append(values, rule.prefix.String())
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+func (f ipRuleFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, err := netip.ParseAddr(v)
+			if err != nil {
+				return fmt.Errorf("invalid address or CIDR %q", v)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		*f.rules = append(*f.rules, ipRule{f.allow, prefix.Masked()})
+	}
+	return nil
+}
+
+func (f ipRuleFlag) reset() {
+	*f.rules = nil
+}
+
+var ipRules []ipRule
+
+func init() {
+	flag.Var(ipRuleFlag{&ipRules, true}, "allow", "Allow clients in a comma-separated list of `CIDRs` or addresses, first match wins (repeatable)")
+	flag.Var(ipRuleFlag{&ipRules, false}, "deny", "Deny clients in a comma-separated list of `CIDRs` or addresses, first match wins (repeatable)")
+}
+
+func allowedIP(rules []ipRule, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	allowRules := false
+	for _, rule := range rules {
+		if rule.prefix.Contains(addr) {
+			return rule.allow
+		}
+		allowRules = allowRules || rule.allow
+	}
+	return !allowRules
+}
+
+func withIPFilter(rules []ipRule, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowedIP(rules, r.RemoteAddr) {
+			http.Error(w, "403 forbidden", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+var (
+	maxConns       = flag.Int("max-conns", 0, "Limit the number of concurrent connections to `n`, rejecting extra connections with 503")
+	maxHeaderBytes = flag.String("max-header-bytes", "", "Reject requests whose headers exceed `size` such as 16KB with 431 (default: 1MB)")
+	maxBody        = flag.String("max-body", "", "Reject request bodies larger than `size` such as 10MB with 413")
+)
+
+const tooManyConnsBody = "503 too many concurrent connections\n"
+
+var tooManyConnsResponse = "HTTP/1.1 503 Service Unavailable\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Connection: close\r\n" +
+	"Retry-After: 1\r\n" +
+	"Content-Length: " + strconv.Itoa(len(tooManyConnsBody)) + "\r\n" +
+	"\r\n" +
+	tooManyConnsBody
+
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	plainHTTP bool
+}
+
+func newLimitListener(l net.Listener, n int, plainHTTP bool) *limitListener {
+	return &limitListener{l, make(chan struct{}, n), plainHTTP}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		select {
+		case l.sem <- struct{}{}:
+			return &limitConn{Conn: conn, release: func() { <-l.sem }}, nil
+		default:
+			if l.plainHTTP {
+				conn.Write([]byte(tooManyConnsResponse))
+			}
+			conn.Close()
+		}
+	}
+}
+
+type limitConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+func withMaxBody(limit int64, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			w.Header().Set("Connection", "close")
+			http.Error(w, "413 request entity too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+
+		h.ServeHTTP(w, r)
+	}
+}
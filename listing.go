@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	listingCSS      = flag.String("listing-css", "", "Add the stylesheet at `file` to directory listings")
+	listingTemplate = flag.String("listing-template", "", "Render directory listings with the Go html/template at `file`")
+	listingPageSize = flag.Int("listing-page-size", 1000, "Split directory listings into pages of `n` entries, unsorted unless a sort is chosen (0 to disable)")
+)
+
+//go:embed listing.html
+var listingHTML string
+
+func parseListingTemplate() (*template.Template, error) {
+	if *listingTemplate != "" {
+		return template.ParseFiles(*listingTemplate)
+	}
+	return template.New("listing").Parse(listingHTML)
+}
+
+type breadcrumb struct {
+	Name string
+	URL  string
+}
+
+type listingEntry struct {
+	Name    string
+	URL     string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+	Icon    string
+	SizeStr string
+}
+
+type listing struct {
+	Path        string
+	Breadcrumbs []breadcrumb
+	Parent      string
+	Entries     []listingEntry
+	Images      []listingEntry
+	Media       []mediaItem
+	Player      bool
+	Upload      bool
+	Sort        string
+	Order       string
+	Sorted      bool
+	Query       string
+	Page        int
+	HasNext     bool
+	Readme      template.HTML
+	CustomCSS   template.CSS
+}
+
+func (l listing) SortURL(column string) string {
+	order := "asc"
+	if l.Sort == column && l.Order == "asc" {
+		order = "desc"
+	}
+	query := url.Values{"sort": {column}, "order": {order}}
+	if l.Query != "" {
+		query.Set("q", l.Query)
+	}
+	return "?" + query.Encode()
+}
+
+type jsonEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Type    string    `json:"type"`
+}
+
+func wantsJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	mediaType, _, _ := mime.ParseMediaType(strings.Split(r.Header.Get("Accept"), ",")[0])
+	return mediaType == "application/json"
+}
+
+func writeJSONListing(w http.ResponseWriter, r *http.Request, entries []listingEntry) {
+	out := make([]jsonEntry, 0, len(entries))
+	for _, entry := range entries {
+		e := jsonEntry{Name: entry.Name, Size: entry.Size, ModTime: entry.ModTime, Type: "file"}
+		if entry.IsDir {
+			e.Type = "dir"
+		}
+		out = append(out, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(out)
+}
+
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+func renderReadme(fs http.FileSystem, dir string) template.HTML {
+	for _, name := range []string{"README.md", "readme.md", "Readme.md", "README.html", "readme.html"} {
+		file, err := fs.Open(dir + name)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			continue
+		}
+
+		if path.Ext(name) == ".html" {
+			return template.HTML(data)
+		}
+
+		out := bytes.Buffer{}
+		if err := markdown.Convert(data, &out); err != nil {
+			continue
+		}
+		return template.HTML(out.String())
+	}
+
+	return ""
+}
+
+func (l listing) PageURL(page int) string {
+	query := url.Values{"page": {strconv.Itoa(page)}}
+	if l.Sorted {
+		query.Set("sort", l.Sort)
+		query.Set("order", l.Order)
+	}
+	if l.Query != "" {
+		query.Set("q", l.Query)
+	}
+	return "?" + query.Encode()
+}
+
+func (l listing) NextURL() string {
+	return l.PageURL(l.Page + 1)
+}
+
+func (l listing) PrevURL() string {
+	return l.PageURL(l.Page - 1)
+}
+
+func (l listing) PlayerURL() string {
+	return l.PageURL(l.Page) + "&view=player"
+}
+
+func readEntries(dir http.File, query string, sorted bool, pageSize, page int) ([]listingEntry, bool, error) {
+	entries := []listingEntry{}
+	skip := (page - 1) * pageSize
+	hasNext := false
+
+	for !hasNext {
+		files, err := dir.Readdir(256)
+		for _, file := range files {
+			if query != "" && !strings.Contains(strings.ToLower(file.Name()), strings.ToLower(query)) {
+				continue
+			}
+
+			if pageSize > 0 && !sorted {
+				if skip > 0 {
+					skip--
+					continue
+				}
+				if len(entries) == pageSize {
+					hasNext = true
+					break
+				}
+			}
+
+			entry := listingEntry{
+				Name:    file.Name(),
+				URL:     url.PathEscape(file.Name()),
+				IsDir:   file.IsDir(),
+				Size:    file.Size(),
+				ModTime: file.ModTime(),
+				Icon:    fileIcon(file.Name(), file.IsDir()),
+				SizeStr: humanSize(file.Size()),
+			}
+			if entry.IsDir {
+				entry.URL += "/"
+				entry.SizeStr = "—"
+			}
+			entries = append(entries, entry)
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return entries, hasNext, nil
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func fileIcon(name string, isDir bool) string {
+	if isDir {
+		return "📁"
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return "🖼️"
+	case strings.HasPrefix(contentType, "video/"):
+		return "🎞️"
+	case strings.HasPrefix(contentType, "audio/"):
+		return "🎵"
+	case strings.HasPrefix(contentType, "text/html"):
+		return "🌐"
+	case strings.HasPrefix(contentType, "text/"), strings.Contains(contentType, "json"), strings.Contains(contentType, "javascript"):
+		return "📝"
+	case strings.Contains(contentType, "pdf"):
+		return "📕"
+	case strings.Contains(contentType, "zip"), strings.Contains(contentType, "tar"), strings.Contains(contentType, "gzip"):
+		return "📦"
+	}
+	return "📄"
+}
+
+func breadcrumbs(urlPath string) []breadcrumb {
+	crumbs := []breadcrumb{{"~", "/"}}
+	current := "/"
+	for _, segment := range strings.Split(strings.Trim(urlPath, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		current += url.PathEscape(segment) + "/"
+		crumbs = append(crumbs, breadcrumb{segment, current})
+	}
+	return crumbs
+}
+
+func sortEntries(entries []listingEntry, column, order string) {
+	less := func(a, b listingEntry) bool {
+		switch column {
+		case "size":
+			return a.Size < b.Size
+		case "modified":
+			return a.ModTime.Before(b.ModTime)
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		if order == "desc" {
+			return less(entries[j], entries[i])
+		}
+		return less(entries[i], entries[j])
+	})
+}
+
+func withListing(fs fileSystem, tmpl *template.Template, customCSS string, h http.Handler) http.HandlerFunc {
+	thumbnails := *gallery
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		urlPath := path.Clean(r.URL.Path)
+		if urlPath != "/" {
+			urlPath += "/"
+		}
+
+		if index, err := fs.openIndex(urlPath); err == nil {
+			index.Close()
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		dir, err := fs.Open(urlPath)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		defer dir.Close()
+
+		stat, err := dir.Stat()
+		if err != nil || !stat.IsDir() {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		l := listing{
+			Path:        urlPath,
+			Breadcrumbs: breadcrumbs(urlPath),
+			Sort:        query.Get("sort"),
+			Order:       query.Get("order"),
+			Sorted:      query.Has("sort"),
+			Query:       query.Get("q"),
+			Page:        1,
+			Player:      query.Get("view") == "player",
+			Upload:      fs.settings.upload,
+			CustomCSS:   template.CSS(customCSS),
+		}
+		if l.Sort == "" {
+			l.Sort = "name"
+		}
+		if l.Order != "desc" {
+			l.Order = "asc"
+		}
+		if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 1 {
+			l.Page = page
+		}
+		if urlPath != "/" {
+			l.Parent = path.Dir(strings.TrimSuffix(urlPath, "/"))
+			if l.Parent != "/" {
+				l.Parent += "/"
+			}
+		}
+
+		pageSize := fs.settings.listingPageSize
+		_, span := tracer.Start(r.Context(), "read directory", trace.WithAttributes(semconv.URLPath(urlPath)))
+		entries, hasNext, err := readEntries(dir, l.Query, l.Sorted, pageSize, l.Page)
+		span.End()
+		if err != nil {
+			http.Error(w, "500 error reading directory", http.StatusInternalServerError)
+			return
+		}
+
+		if l.Sorted || pageSize == 0 || (l.Page == 1 && !hasNext) {
+			sortEntries(entries, l.Sort, l.Order)
+		}
+		if l.Sorted && pageSize > 0 {
+			start := min((l.Page-1)*pageSize, len(entries))
+			end := min(start+pageSize, len(entries))
+			hasNext = end < len(entries)
+			entries = entries[start:end]
+		}
+
+		l.Entries, l.HasNext = entries, hasNext
+		if thumbnails {
+			l.Entries = l.Entries[:0:0]
+			for _, entry := range entries {
+				if !entry.IsDir && isImage(entry.Name) {
+					l.Images = append(l.Images, entry)
+				} else {
+					l.Entries = append(l.Entries, entry)
+				}
+			}
+		}
+		l.Media = mediaPlaylist(entries)
+		l.Readme = renderReadme(fs, urlPath)
+
+		if l.HasNext {
+			w.Header().Add("Link", "<"+l.NextURL()+`>; rel="next"`)
+		}
+		if l.Page > 1 {
+			w.Header().Add("Link", "<"+l.PrevURL()+`>; rel="prev"`)
+		}
+		addVary(w.Header(), "Accept")
+		w.Header().Set("Last-Modified", stat.ModTime().UTC().Format(http.TimeFormat))
+		if wantsJSON(r) {
+			writeJSONListing(w, r, entries)
+			return
+		}
+
+		debugf(r, "rendering directory listing for %s", urlPath)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if r.Method == http.MethodHead {
+			return
+		}
+		if err := tmpl.Execute(w, l); err != nil {
+			fmt.Fprintln(errorLog, "Error rendering listing:", err)
+		}
+	}
+}
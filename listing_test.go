@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type batchedDir struct {
+	http.File
+	files []os.FileInfo
+}
+
+func (d *batchedDir) Readdir(count int) ([]os.FileInfo, error) {
+	if len(d.files) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.files))
+	files := d.files[:n]
+	d.files = d.files[n:]
+	return files, nil
+}
+
+func TestReadEntriesAfterHiddenBatch(t *testing.T) {
+	root := t.TempDir()
+	names := []string{}
+	for i := range 300 {
+		names = append(names, fmt.Sprintf(".hidden%03d", i))
+	}
+	names = append(names, "a.txt", "b.txt")
+
+	files := []os.FileInfo{}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		stat, err := os.Stat(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, stat)
+	}
+
+	entries, _, err := readEntries(filteredDirFile{File: &batchedDir{files: files}, settings: &settings{}}, "", false, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "a.txt" || entries[1].Name != "b.txt" {
+		t.Fatalf("got %d entries, want a.txt and b.txt", len(entries))
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	logFile       = flag.String("log-file", "", "Write the access log to `file` instead of standard output, rotating it by size and age")
+	logMaxSize    = flag.String("log-max-size", "100MB", "Rotate the -log-file once it reaches `size` (0 to disable)")
+	logMaxAge     = flag.Duration("log-max-age", 0, "Rotate the -log-file once it is older than `duration`, such as 24h")
+	logMaxBackups = flag.Int("log-max-backups", 10, "Keep at most `n` rotated log files (0 to keep all)")
+	logCompress   = flag.Bool("log-compress", false, "Compress rotated log files with gzip")
+)
+
+type rotatingFile struct {
+	name       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+	compress   bool
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func newRotatingFile(name string) (*rotatingFile, error) {
+	maxSize := 0.0
+	if *logMaxSize != "0" {
+		var err error
+		if maxSize, err = parseSize(*logMaxSize); err != nil {
+			return nil, err
+		}
+	}
+
+	f := &rotatingFile{
+		name:       name,
+		maxSize:    int64(maxSize),
+		maxAge:     *logMaxAge,
+		maxBackups: *logMaxBackups,
+		compress:   *logCompress,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file, f.size, f.opened = file, stat.Size(), time.Now()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	full := f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	old := f.maxAge > 0 && f.size > 0 && time.Since(f.opened) >= f.maxAge
+	if full || old {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintln(errorLog, "Error rotating log file:", err)
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *rotatingFile) rotate() error {
+	ext := filepath.Ext(f.name)
+	backup := strings.TrimSuffix(f.name, ext) + "-" + time.Now().Format("20060102T150405.000") + ext
+
+	f.file.Close()
+	if err := os.Rename(f.name, backup); err != nil {
+		f.open()
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	go func() {
+		if f.compress {
+			if err := compressFile(backup); err != nil {
+				fmt.Fprintln(errorLog, "Error compressing log file:", err)
+			}
+		}
+		f.removeBackups()
+	}()
+	return nil
+}
+
+func (f *rotatingFile) removeBackups() {
+	if f.maxBackups <= 0 {
+		return
+	}
+
+	ext := filepath.Ext(f.name)
+	backups, err := filepath.Glob(strings.TrimSuffix(f.name, ext) + "-*" + ext + "*")
+	if err != nil || len(backups) <= f.maxBackups {
+		return
+	}
+
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-f.maxBackups] {
+		os.Remove(backup)
+	}
+}
+
+func compressFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(name + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(name + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(name)
+}
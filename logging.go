@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	logFormat  = flag.String("log-format", "text", "Set the access log `format`: text, json (one object per line), Apache common or combined, or a custom format such as '%t %s %m %U %Dms %b'")
+	logStatus  = flag.String("log-status", "", "Only log responses matching a comma-separated list of `statuses` such as 4xx,5xx or 404")
+	verbose    = flag.Bool("v", false, "Add the method, response size, client address, referer and user agent to text log lines")
+	syslogAddr = flag.String("syslog", "", "Send access and error logs to syslog at `address`: local for the system logger or journal, or udp://host:port or tcp://host:port")
+)
+
+var (
+	errorLog     io.Writer = os.Stderr
+	accessOutput io.Writer = os.Stdout
+)
+
+func setupSyslog() error {
+	network, addr := "", ""
+	if *syslogAddr != "local" {
+		u, err := url.Parse(*syslogAddr)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return fmt.Errorf("invalid syslog address %q", *syslogAddr)
+		}
+		network, addr = u.Scheme, u.Host
+	}
+
+	access, errs, err := openSyslog(network, addr)
+	if err != nil {
+		return err
+	}
+	accessOutput, errorLog = access, errs
+	return nil
+}
+
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (lrw *loggingResponseWriter) WriteHeader(status int) {
+	lrw.status = status
+	lrw.ResponseWriter.WriteHeader(status)
+}
+
+func (lrw *loggingResponseWriter) Write(p []byte) (int, error) {
+	n, err := lrw.ResponseWriter.Write(p)
+	lrw.bytes += int64(n)
+	return n, err
+}
+
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
+func (lrw *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(lrw.ResponseWriter).Hijack()
+	if err == nil {
+		lrw.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+type accessLog struct {
+	r        *http.Request
+	header   http.Header
+	time     time.Time
+	status   int
+	bytes    int64
+	duration time.Duration
+	color    bool
+	verbose  bool
+	showID   bool
+}
+
+type jsonAccessLog struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Duration  float64   `json:"duration_ms"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	RequestID string    `json:"request_id,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	City      string    `json:"city,omitempty"`
+}
+
+var logFormats = map[string]func(accessLog) string{
+	"text":     formatTextLog,
+	"json":     formatJSONLog,
+	"common":   formatCommonLog,
+	"combined": formatCombinedLog,
+}
+
+func formatTextLog(l accessLog) string {
+	statusColor := "32"
+	if l.status >= 400 {
+		statusColor = "31"
+	} else if l.status >= 300 {
+		statusColor = "33"
+	}
+
+	timestamp := paint(l.color, "90", "["+l.time.Format(time.TimeOnly)+"]")
+	status := paint(l.color, statusColor, strconv.Itoa(l.status))
+	duration := paint(l.color, "90", fmt.Sprintf("(%.2fms)", milliseconds(l.duration)))
+
+	line := fmt.Sprintf("%s %s %s %s", timestamp, status, l.r.URL.Path, duration)
+	if l.verbose {
+		client := remoteIP(l.r)
+		if loc := lookupLocation(l.r).String(); loc != "" {
+			client += " (" + loc + ")"
+		}
+		line = fmt.Sprintf(
+			"%s %s %s %s %s %s %s",
+			timestamp, status, l.r.Method, l.r.URL.Path, humanSize(l.bytes), duration,
+			paint(l.color, "90", fmt.Sprintf("%s %q %q", client, dashIfEmpty(l.r.Referer()), dashIfEmpty(l.r.UserAgent()))),
+		)
+	}
+
+	if id := l.requestID(); id != "" {
+		line += " " + paint(l.color, "90", "id="+id)
+	}
+	return line
+}
+
+func (l accessLog) requestID() string {
+	if !l.showID {
+		return ""
+	}
+	return l.r.Header.Get("X-Request-Id")
+}
+
+func formatJSONLog(l accessLog) string {
+	loc := lookupLocation(l.r)
+	line, _ := json.Marshal(jsonAccessLog{
+		Time:      l.time.UTC(),
+		Method:    l.r.Method,
+		Path:      l.r.URL.Path,
+		Status:    l.status,
+		Bytes:     l.bytes,
+		Duration:  milliseconds(l.duration),
+		IP:        remoteIP(l.r),
+		UserAgent: l.r.UserAgent(),
+		RequestID: l.requestID(),
+		Country:   loc.country,
+		City:      loc.city,
+	})
+	return string(line)
+}
+
+func formatCommonLog(l accessLog) string {
+	return fmt.Sprintf(
+		"%s - %s %s %q %d %s",
+		remoteIP(l.r), logUser(l), logTime(l), requestLine(l), l.status, logBytes(l),
+	)
+}
+
+func formatCombinedLog(l accessLog) string {
+	return fmt.Sprintf("%s %q %q", formatCommonLog(l), dashIfEmpty(l.r.Referer()), dashIfEmpty(l.r.UserAgent()))
+}
+
+func logUser(l accessLog) string {
+	return requestUser(l.r)
+}
+
+func logTime(l accessLog) string {
+	return l.time.Format("[02/Jan/2006:15:04:05 -0700]")
+}
+
+func requestLine(l accessLog) string {
+	return l.r.Method + " " + l.r.RequestURI + " " + l.r.Proto
+}
+
+func logBytes(l accessLog) string {
+	if l.bytes == 0 {
+		return "-"
+	}
+	return strconv.FormatInt(l.bytes, 10)
+}
+
+var logDirectives = map[byte]func(accessLog) string{
+	'h': func(l accessLog) string { return remoteIP(l.r) },
+	'u': logUser,
+	't': logTime,
+	'r': requestLine,
+	'm': func(l accessLog) string { return l.r.Method },
+	'U': func(l accessLog) string { return l.r.URL.Path },
+	'q': func(l accessLog) string {
+		if l.r.URL.RawQuery == "" {
+			return ""
+		}
+		return "?" + l.r.URL.RawQuery
+	},
+	'H': func(l accessLog) string { return l.r.Proto },
+	'v': func(l accessLog) string { return l.r.Host },
+	's': func(l accessLog) string { return strconv.Itoa(l.status) },
+	'b': logBytes,
+	'B': func(l accessLog) string { return strconv.FormatInt(l.bytes, 10) },
+	'D': func(l accessLog) string { return strconv.FormatFloat(milliseconds(l.duration), 'f', 2, 64) },
+	'T': func(l accessLog) string { return strconv.FormatFloat(l.duration.Seconds(), 'f', 3, 64) },
+}
+
+func parseLogFormat(format string) (func(accessLog) string, error) {
+	if f, ok := logFormats[format]; ok {
+		return f, nil
+	}
+	if !strings.Contains(format, "%") {
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+
+	parts := []func(accessLog) string{}
+	literal := func(s string) func(accessLog) string {
+		return func(accessLog) string { return s }
+	}
+
+	for format != "" {
+		i := strings.IndexByte(format, '%')
+		if i < 0 {
+			parts = append(parts, literal(format))
+			break
+		}
+		if i > 0 {
+			parts = append(parts, literal(format[:i]))
+		}
+		format = format[i+1:]
+
+		if format == "" {
+			return nil, errors.New("log format ends with %")
+		}
+		if format[0] == '%' {
+			parts = append(parts, literal("%"))
+			format = format[1:]
+			continue
+		}
+
+		if format[0] == '{' {
+			end := strings.IndexByte(format, '}')
+			if end < 0 || end+1 >= len(format) {
+				return nil, errors.New("unterminated %{ in log format")
+			}
+			name := format[1:end]
+			switch format[end+1] {
+			case 'i':
+				parts = append(parts, func(l accessLog) string { return dashIfEmpty(l.r.Header.Get(name)) })
+			case 'o':
+				parts = append(parts, func(l accessLog) string { return dashIfEmpty(l.header.Get(name)) })
+			default:
+				return nil, fmt.Errorf("unknown log format directive %%{%s}%c", name, format[end+1])
+			}
+			format = format[end+2:]
+			continue
+		}
+
+		directive, ok := logDirectives[format[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown log format directive %%%c", format[0])
+		}
+		parts = append(parts, directive)
+		format = format[1:]
+	}
+
+	return func(l accessLog) string {
+		out := strings.Builder{}
+		for _, part := range parts {
+			out.WriteString(part(l))
+		}
+		return out.String()
+	}, nil
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+type statusFilter []string
+
+func parseStatusFilter(value string) (statusFilter, error) {
+	filter := statusFilter{}
+	for _, s := range strings.Split(value, ",") {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if len(s) != 3 || s[0] < '1' || s[0] > '5' || strings.Trim(s[1:], "0123456789") != "" && s[1:] != "xx" {
+			return nil, fmt.Errorf("invalid status %q", s)
+		}
+		filter = append(filter, s)
+	}
+	return filter, nil
+}
+
+func (f statusFilter) match(status int) bool {
+	if f == nil {
+		return true
+	}
+
+	code := strconv.Itoa(status)
+	for _, s := range f {
+		if s == code || s[1:] == "xx" && s[0] == code[0] {
+			return true
+		}
+	}
+	return false
+}
+
+type accessLogger struct {
+	format   func(accessLog) string
+	out      io.Writer
+	color    bool
+	verbose  bool
+	showID   bool
+	statuses statusFilter
+}
+
+func withLogging(logger accessLogger, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r = trackUser(r)
+
+		lrw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(lrw, r)
+
+		if !logger.statuses.match(lrw.status) {
+			return
+		}
+
+		line := logger.format(accessLog{r, lrw.Header(), time.Now(), lrw.status, lrw.bytes, time.Since(start), logger.color, logger.verbose, logger.showID})
+		if _, err := io.WriteString(logger.out, line+"\n"); err != nil {
+			fmt.Fprintln(errorLog, "Error writing access log:", err)
+		}
+	}
+}
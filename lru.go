@@ -0,0 +1,72 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+	size  int64
+}
+
+type lruCache[K comparable, V any] struct {
+	mu      sync.Mutex
+	maxSize int64
+	size    int64
+	sizeOf  func(V) int64
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+func newLRUCache[K comparable, V any](maxSize int64, sizeOf func(V) int64) *lruCache[K, V] {
+	if sizeOf == nil {
+		sizeOf = func(V) int64 { return 1 }
+	}
+	return &lruCache[K, V]{
+		maxSize: maxSize,
+		sizeOf:  sizeOf,
+		order:   list.New(),
+		entries: map[K]*list.Element{},
+	}
+}
+
+func (c *lruCache[K, V]) get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry[K, V]).value, true
+}
+
+func (c *lruCache[K, V]) add(key K, value V) {
+	size := c.sizeOf(value)
+	if size > c.maxSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key, value, size})
+	c.size += size
+
+	for c.size > c.maxSize {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *lruCache[K, V]) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*lruEntry[K, V])
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
@@ -2,16 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
+
+	"github.com/andybalholm/brotli"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 var (
@@ -19,22 +28,50 @@ var (
 	hiddenFiles = flag.Bool("a", false, "Serve all files, including hidden files")
 	dirListings = flag.Bool("d", false, "Enable directory listings")
 	quiet       = flag.Bool("q", false, "Disable logging")
+	enableH2C   = flag.Bool("h2c", false, "Enable HTTP/2 over cleartext connections")
+	spa         = flag.Bool("s", false, "Serve index.html for paths that don't match a file (single-page app mode)")
+	indexFiles  = flag.String("index", "index.html", "Serve the first existing file from a comma-separated list of `files` for directories")
 )
 
+func init() {
+	flag.BoolVar(spa, "spa", false, "Alias for -s")
+}
+
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func (l *listFlag) reset() {
+	*l = nil
+}
+
+func (l *listFlag) values() []string {
+	return *l
+}
+
 type filteredDirFile struct {
 	http.File
+	settings *settings
+	dir      string
 }
 
 func (f filteredDirFile) Readdir(count int) ([]os.FileInfo, error) {
 	files, err := f.File.Readdir(count)
 
-	if *hiddenFiles {
+	if f.settings.hiddenFiles && f.settings.configPath == "" {
 		return files, err
 	}
 
 	filtered := []os.FileInfo{}
 	for _, file := range files {
-		if !strings.HasPrefix(file.Name(), ".") {
+		if !f.settings.isHiddenPath(strings.TrimSuffix(f.dir, "/") + "/" + file.Name()) {
 			filtered = append(filtered, file)
 		}
 	}
@@ -42,29 +79,45 @@ func (f filteredDirFile) Readdir(count int) ([]os.FileInfo, error) {
 	return filtered, err
 }
 
+func (s *settings) isHiddenPath(urlPath string) bool {
+	if s.configPath != "" && path.Clean("/"+urlPath) == s.configPath {
+		return true
+	}
+	if s.hiddenFiles {
+		return false
+	}
+	for _, s := range strings.Split(urlPath, "/") {
+		if strings.HasPrefix(s, ".") {
+			return true
+		}
+	}
+	return false
+}
+
 type fileSystem struct {
 	http.FileSystem
+	settings *settings
 }
 
 func (fs fileSystem) Open(path string) (http.File, error) {
-	if !*hiddenFiles {
-		for _, s := range strings.Split(path, "/") {
-			if strings.HasPrefix(s, ".") {
-				return nil, os.ErrPermission
-			}
-		}
+	if fs.settings.isHiddenPath(path) {
+		return nil, os.ErrPermission
+	}
+
+	if strings.HasSuffix(path, "/index.html") {
+		return fs.openIndex(strings.TrimSuffix(path, "index.html"))
 	}
 
 	file, err := fs.FileSystem.Open(path)
 	if err != nil {
-		if os.IsNotExist(err) && filepath.Ext(path) == "" {
+		if os.IsNotExist(err) && fs.settings.cleanURLs != "off" && filepath.Ext(path) == "" {
 			return fs.FileSystem.Open(path + ".html")
 		}
 		return nil, err
 	}
 
-	if *dirListings {
-		return filteredDirFile{file}, nil
+	if fs.settings.dirListings {
+		return filteredDirFile{file, fs.settings, path}, nil
 	}
 
 	stat, err := file.Stat()
@@ -74,46 +127,43 @@ func (fs fileSystem) Open(path string) (http.File, error) {
 	}
 
 	if stat.IsDir() {
-		index := filepath.Join(path, "index.html")
-		if _, err := fs.FileSystem.Open(index); os.IsNotExist(err) {
+		index, err := fs.openIndex(strings.TrimSuffix(path, "/") + "/")
+		if err != nil {
 			file.Close()
-			return nil, os.ErrNotExist
+			return nil, err
 		}
+		index.Close()
 	}
 
 	return file, nil
 }
 
-type loggingResponseWriter struct {
-	http.ResponseWriter
-	status int
-}
+func (fs fileSystem) openIndex(dir string) (http.File, error) {
+	for _, name := range fs.settings.indexFiles {
+		file, err := fs.FileSystem.Open(dir + name)
+		if err == nil {
+			return file, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
 
-func (lrw *loggingResponseWriter) WriteHeader(status int) {
-	lrw.status = status
-	lrw.ResponseWriter.WriteHeader(status)
+	return nil, os.ErrNotExist
 }
 
-func withLogging(h http.Handler) http.HandlerFunc {
+func withSPAFallback(fs http.FileSystem, h http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-
-		lrw := &loggingResponseWriter{w, http.StatusOK}
-		h.ServeHTTP(lrw, r)
-
-		duration := float64(time.Since(start).Microseconds()) / 1000
-
-		statusColor := "32m"
-		if lrw.status >= 400 {
-			statusColor = "31m"
-		} else if lrw.status >= 300 {
-			statusColor = "33m"
+		file, err := fs.Open(path.Clean("/" + r.URL.Path))
+		if err == nil {
+			file.Close()
+		} else if os.IsNotExist(err) {
+			debugf(r, "no file for %s, serving / (single-page app fallback)", r.URL.Path)
+			r = r.Clone(r.Context())
+			r.URL.Path = "/"
 		}
 
-		fmt.Printf(
-			"\033[90m[%s]\033[0m \033[%s%d\033[0m %s \033[90m(%.2fms)\033[0m\n",
-			time.Now().Format(time.TimeOnly), statusColor, lrw.status, r.URL.Path, duration,
-		)
+		h.ServeHTTP(w, r)
 	}
 }
 
@@ -132,18 +182,13 @@ func getLocalIP() string {
 	return ""
 }
 
-func run(root string) error {
-	handler := http.FileServer(fileSystem{http.Dir(root)})
-	if !*quiet {
-		handler = withLogging(handler)
-	}
-
-	host, port, err := net.SplitHostPort(*addr)
+func splitAddr(addr string) (string, string, error) {
+	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
-		if _, err2 := strconv.Atoi(*addr); err2 == nil {
-			port = *addr
+		if _, err2 := strconv.Atoi(addr); err2 == nil {
+			port = addr
 		} else {
-			return err
+			return "", "", err
 		}
 	}
 
@@ -151,31 +196,661 @@ func run(root string) error {
 		host = "localhost"
 	}
 
+	return host, port, nil
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func newHandler(s *site) (http.Handler, error) {
+	cfg, hub := s.settings, s.hub
+	root := cfg.root
+	fs := fileSystem{http.Dir(root), cfg}
+
+	encodings, err := parseEncodings(*compressors)
+	if err != nil {
+		return nil, err
+	}
+	if *noCompress {
+		encodings = nil
+	}
+
+	var scopes []authScope
+	if *basicAuth != "" || len(htpasswdFiles) != 0 {
+		if scopes, err = parseAuthScopes(); err != nil {
+			return nil, err
+		}
+	}
+
+	var handler http.Handler = withETags(fs, http.FileServer(fs))
+	if debugging() {
+		handler = withDebugFiles(cfg, handler)
+	}
+	if *otelTracing {
+		handler = withFileSpans(root, handler)
+	}
+	if cfg.dirListings {
+		tmpl, err := parseListingTemplate()
+		if err != nil {
+			return nil, err
+		}
+
+		customCSS := ""
+		if *listingCSS != "" {
+			data, err := os.ReadFile(*listingCSS)
+			if err != nil {
+				return nil, err
+			}
+			customCSS = string(data)
+		}
+		handler = withListing(fs, tmpl, customCSS, handler)
+		handler = withArchives(fs, scopes, handler)
+	}
+
+	if *gallery {
+		handler = withThumbnails(fs, handler)
+	}
+	if *checksums {
+		handler = withChecksums(cfg, scopes, fs, handler)
+	}
+	if *prettySource {
+		handler = withPrettySource(fs, handler)
+	}
+	if len(encodings) != 0 {
+		handler = withPrecompressed(fs, encodings, handler)
+	}
+
+	if *preload {
+		cache, err := buildPreloadCache(cfg, encodings)
+		if err != nil {
+			return nil, err
+		}
+		handler = withPreload(cache, encodings, handler)
+	}
+
+	if *ssi {
+		handler = withSSI(fs, handler)
+	}
+
+	if *envSubst || *envFile != "" {
+		var file *ruleFile[envVar]
+		if *envFile != "" {
+			if _, err := parseEnvFile(*envFile); err != nil {
+				return nil, err
+			}
+			file = &ruleFile[envVar]{name: *envFile, parse: parseEnvFile}
+		}
+		handler = withEnvSubst(file, handler)
+	}
+
+	if *minifyText {
+		handler = withMinify(handler)
+	}
+
+	if hub != nil {
+		handler = withLiveReload(handler)
+	}
+
+	if len(cacheRules) != 0 {
+		rules, err := parseCacheRules(cacheRules)
+		if err != nil {
+			return nil, err
+		}
+		handler = withCacheControl(rules, handler)
+	}
+
+	if !*noFingerprint {
+		handler = withFingerprints(http.Dir(root), handler)
+	}
+
+	if *preloadLinks || *preloadManifest != "" || *earlyHints {
+		var manifest *ruleFile[preloadRule]
+		if *preloadManifest != "" {
+			manifest = &ruleFile[preloadRule]{name: *preloadManifest, parse: parsePreloadManifest}
+		}
+		handler = withPreloadLinks(&pageScanner{fs: fs, pages: map[string]scannedPage{}}, manifest, handler)
+	}
+
+	if *tryFiles != "" {
+		candidates, err := parseTryFiles(*tryFiles)
+		if err != nil {
+			return nil, err
+		}
+		handler = withTryFiles(fs, candidates, handler)
+	}
+
+	if *trailingSlash != "" {
+		if err := validateTrailingSlash(*trailingSlash); err != nil {
+			return nil, err
+		}
+		handler = withTrailingSlash(fs, *trailingSlash, handler)
+	}
+
+	if err := validateCleanURLs(cfg.cleanURLs); err != nil {
+		return nil, err
+	}
+	if cfg.cleanURLs == "redirect" {
+		handler = withCleanURLRedirects(fs, handler)
+	}
+
+	if *spa {
+		handler = withSPAFallback(fs, handler)
+	}
+
+	if len(rewrites) != 0 {
+		rules, err := parseRewrites(rewrites)
+		if err != nil {
+			return nil, err
+		}
+		handler = withRewrites(rules, handler)
+	}
+
+	handler = withRedirects(fs, &ruleFile[redirectRule]{
+		name:  filepath.Join(root, "_redirects"),
+		parse: parseRedirects,
+	}, handler)
+
+	handler = withHeaderRules(&ruleFile[headerRule]{
+		name:  filepath.Join(root, "_headers"),
+		parse: parseHeaders,
+	}, handler)
+
+	if *hotlink || len(hotlinkAllow) != 0 {
+		placeholder := ""
+		if *hotlinkPlaceholder != "" {
+			placeholder = path.Clean("/" + *hotlinkPlaceholder)
+		}
+		handler = withHotlinkProtection(http.Dir(root), parseHotlinkHosts(hotlinkAllow), placeholder, handler)
+	}
+
+	if cfg.upload {
+		maxSize := 0.0
+		if *maxBody != "" {
+			if maxSize, err = parseSize(*maxBody); err != nil {
+				return nil, err
+			}
+		}
+		handler = withUploads(cfg, handler)
+		handler = withTus(cfg, int64(maxSize), handler)
+	}
+
+	if *webDAV || *webDAVWrite {
+		handler = withWebDAV(cfg, *webDAVWrite, handler)
+	}
+
+	if len(proxyRules) != 0 {
+		rules, err := parseProxyRules(proxyRules)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			if rule.healthPath != "" {
+				s.closers = append(s.closers, rule)
+				go rule.watchHealth()
+			}
+		}
+		handler = withProxy(rules, handler)
+	}
+
+	if *mockDir != "" {
+		handler = withMocks(cfg, *mockDir, handler)
+	}
+
+	if len(corsProxyHosts) != 0 {
+		handler = withCORSProxy(parseHotlinkHosts(corsProxyHosts), handler)
+	}
+
+	if *analytics {
+		handler = withAnalytics(siteAnalytics, handler)
+	}
+
+	public, authenticated := handler, false
+	protected := func(string) bool { return false }
+
+	if *manage {
+		handler = withManageAPI(cfg, handler)
+	}
+
+	if *webDashboard {
+		handler = withWebDashboard(root, handler)
+	}
+
+	if *analytics {
+		handler = withAnalyticsPage(siteAnalytics, handler)
+	}
+
+	if hub != nil {
+		handler = withWatchEvents(hub, handler)
+	}
+
+	if *auditLog != "" {
+		logger, err := newAuditLogger(*auditLog)
+		if err != nil {
+			return nil, err
+		}
+		s.closers = append(s.closers, logger)
+		handler = withAuditLog(logger, handler)
+	}
+
+	if len(scopes) != 0 {
+		handler = withBasicAuth(scopes, handler)
+		authenticated = true
+		protected = func(urlPath string) bool { return scopesCover(scopes, urlPath) }
+	}
+
+	if *bearerToken != "" || *jwksURL != "" || *jwtIssuer != "" || *jwtAudience != "" {
+		if len(scopes) != 0 {
+			return nil, errors.New("-token and -jwks can't be combined with -auth or -htpasswd, which use the same Authorization header")
+		}
+		check, err := newBearerCheck()
+		if err != nil {
+			return nil, err
+		}
+		handler = withBearerAuth(check, handler)
+		authenticated = true
+		protected = func(string) bool { return true }
+	}
+
+	if *oidcIssuer != "" {
+		provider, err := newOIDCProvider()
+		if err != nil {
+			return nil, err
+		}
+		handler = withOIDC(provider, handler)
+		authenticated = true
+		protected = func(string) bool { return len(oidcAllow) != 0 }
+	}
+
+	if *manage && !protected("/_api") {
+		return nil, errors.New("-manage requires authentication covering /_api/ such as -auth or -htpasswd")
+	}
+	if *webDashboard && !protected("/_dashboard") {
+		return nil, errors.New("-dashboard requires authentication covering /_dashboard such as -auth or -htpasswd")
+	}
+	if *webDAVWrite && !protected("/") {
+		return nil, errors.New("-webdav-write requires authentication covering the root such as -auth or -htpasswd")
+	}
+	if *analytics && !protected("/_stats") {
+		return nil, errors.New("-analytics requires authentication covering /_stats such as -auth or -htpasswd")
+	}
+
+	if *signKey != "" {
+		var unsigned http.Handler
+		if authenticated {
+			unsigned = handler
+		}
+		handler = withSignedURLs(*signKey, public, unsigned)
+	}
+
+	if len(errorPages) != 0 {
+		pages, err := parseErrorPages(errorPages)
+		if err != nil {
+			return nil, err
+		}
+		handler = withErrorPages(http.Dir(root), pages, handler)
+	}
+
+	if *headersFile != "" {
+		if _, err := parseHeaders(*headersFile); err != nil {
+			return nil, err
+		}
+		handler = withHeaderRules(&ruleFile[headerRule]{
+			name:  *headersFile,
+			parse: parseHeaders,
+		}, handler)
+	}
+
+	if len(customHeaders) != 0 {
+		headers, err := parseCustomHeaders(customHeaders)
+		if err != nil {
+			return nil, err
+		}
+		handler = withHeaders(headers, handler)
+	}
+
+	if *secure {
+		headers, err := securityHeaders()
+		if err != nil {
+			return nil, err
+		}
+		handler = withHeaders(headers, handler)
+	}
+
+	if *serverName != "" || *hideIdentity {
+		handler = withIdentity(*serverName, *hideIdentity, handler)
+	}
+
+	if *cors || len(corsOrigins) != 0 {
+		handler = withCORS(newCORSPolicy(), handler)
+	}
+
+	if len(encodings) != 0 {
+		if cfg.brotliLevel < brotli.BestSpeed || cfg.brotliLevel > brotli.BestCompression {
+			return nil, fmt.Errorf("invalid Brotli quality %d", cfg.brotliLevel)
+		}
+		handler = withCompression(cfg, encodings, handler)
+	}
+
+	if len(ipRules) != 0 {
+		handler = withIPFilter(ipRules, handler)
+	}
+
+	if len(uaAllow) != 0 || len(uaDeny) != 0 {
+		allow, err := compilePatterns(uaAllow)
+		if err != nil {
+			return nil, err
+		}
+		deny, err := compilePatterns(uaDeny)
+		if err != nil {
+			return nil, err
+		}
+		handler = withUserAgentFilter(cfg, allow, deny, handler)
+	}
+
+	if *maxBody != "" {
+		limit, err := parseSize(*maxBody)
+		if err != nil {
+			return nil, err
+		}
+		handler = withMaxBody(int64(limit), handler)
+	}
+
+	profile, ok := networkProfiles[*network]
+	if !ok && *network != "" {
+		return nil, fmt.Errorf("unknown network profile %q", *network)
+	}
+	if profile.latency != 0 {
+		handler = withLatency(profile.latency, handler)
+	}
+
+	if faults := chaosFaults(); len(faults) != 0 {
+		if *chaosRate < 0 || *chaosRate > 100 {
+			return nil, fmt.Errorf("invalid chaos rate %g", *chaosRate)
+		}
+		handler = withChaos(*chaosRate, faults, handler)
+	}
+
+	if !cfg.quiet {
+		format, err := parseLogFormat(*logFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		var statuses statusFilter
+		if *logStatus != "" {
+			if statuses, err = parseStatusFilter(*logStatus); err != nil {
+				return nil, err
+			}
+		}
+
+		out := accessOutput
+		if *logFile != "" {
+			file, err := newRotatingFile(*logFile)
+			if err != nil {
+				return nil, err
+			}
+			s.closers = append(s.closers, file)
+			out = file
+		}
+		handler = withLogging(accessLogger{format, out, useColor && out == os.Stdout, cfg.verbose, *requestID, statuses}, handler)
+	}
+
+	if debugging() {
+		handler = withDebug(*debugBody, handler)
+	}
+
+	if *requestID {
+		handler = withRequestID(handler)
+	}
+
+	if *otelTracing {
+		handler = withTracing(handler)
+	}
+
+	return handler, nil
+}
+
+func run(root string) error {
+	sigint := make(chan os.Signal, 1)
+	signal.Notify(sigint, os.Interrupt)
+
+	var dash *dashboard
+	if *tui {
+		var err error
+		if dash, err = newDashboard(func() { sigint <- os.Interrupt }); err != nil {
+			return err
+		}
+		accessOutput, errorLog = io.Discard, dash
+	}
+
+	if *syslogAddr != "" {
+		if err := setupSyslog(); err != nil {
+			return err
+		}
+	}
+
+	shutdownTracing := func(context.Context) error { return nil }
+	if *otelTracing {
+		var err error
+		if shutdownTracing, err = setupTracing(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	if *geoIPFile != "" {
+		db, err := openGeoIP(*geoIPFile)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		geoDB = db
+	}
+
+	if *analytics && *analyticsFile != "" {
+		if err := siteAnalytics.load(*analyticsFile); err != nil {
+			return err
+		}
+		go siteAnalytics.saveEvery(*analyticsFile, *analyticsInterval)
+	}
+
+	current, err := newSite(root)
+	if err != nil {
+		return err
+	}
+
+	sites := &siteHandler{}
+	sites.current.Store(current)
+
+	var handler http.Handler = sites
+	if !*quiet || *webDashboard || *debugAddr != "" {
+		handler = withStats(traffic, handler)
+	}
+	if dash != nil {
+		handler = withDashboard(dash, handler)
+	}
+	if *healthChecks {
+		handler = withHealthChecks(sites, handler)
+	}
+	if *enableH2C {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+
+	if *domains != "" && !isFlagSet("l") {
+		*addr = "0.0.0.0:443"
+	}
+
+	host, port, err := splitAddr(*addr)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := newTLSConfig(host)
+	if err != nil {
+		return err
+	}
+
 	server := http.Server{
-		Addr:    net.JoinHostPort(host, port),
-		Handler: handler,
+		Addr:      net.JoinHostPort(host, port),
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	if dash != nil {
+		server.ConnState = dash.connState
+	}
+
+	if *maxHeaderBytes != "" {
+		limit, err := parseSize(*maxHeaderBytes)
+		if err != nil {
+			return err
+		}
+		server.MaxHeaderBytes = int(limit)
+	}
+	if *syslogAddr != "" {
+		server.ErrorLog = log.New(errorLog, "", 0)
+	}
+
+	if *debugAddr != "" {
+		debugServer, err := newDebugServer(*debugAddr)
+		if err != nil {
+			return err
+		}
+
+		go func() {
+			if err := debugServer.ListenAndServe(); err != http.ErrServerClosed {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	var redirectServer *http.Server
+	if *redirectAddr != "" {
+		if tlsConfig == nil {
+			return errors.New("-redirect-http requires HTTPS to be enabled")
+		}
+
+		redirectHost, redirectPort, err := splitAddr(*redirectAddr)
+		if err != nil {
+			return err
+		}
+
+		redirectServer = &http.Server{
+			Addr:    net.JoinHostPort(redirectHost, redirectPort),
+			Handler: redirectToHTTPS(port),
+		}
+
+		go func() {
+			if err := redirectServer.ListenAndServe(); err != http.ErrServerClosed {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	var console io.Writer = os.Stdout
+	if *logFormat != "text" {
+		console = os.Stderr
+	}
+
+	analyticsPath, summary := "", !*quiet
+	if *analytics {
+		analyticsPath = *analyticsFile
 	}
 
 	idleConnsClosed := make(chan struct{})
 	go func() {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
 		<-sigint
-		fmt.Printf("\n\nShutting down...\n\n")
+		if dash != nil {
+			dash.close()
+		}
+		fmt.Fprintf(console, "\n\nShutting down...\n\n")
+		if redirectServer != nil {
+			redirectServer.Shutdown(context.Background())
+		}
 		server.Shutdown(context.Background())
+		shutdownTracing(context.Background())
+		if analyticsPath != "" {
+			if err := siteAnalytics.save(analyticsPath); err != nil {
+				fmt.Fprintln(errorLog, "Error saving analytics:", err)
+			}
+		}
+		if summary {
+			traffic.writeSummary(console)
+		}
 		close(idleConnsClosed)
 	}()
 
-	url := "http://" + server.Addr
-	if host == "0.0.0.0" {
+	scheme := "http://"
+	if tlsConfig != nil {
+		scheme = "https://"
+	}
+
+	url := scheme + server.Addr
+	if *domains != "" {
+		domain := strings.TrimSpace(strings.Split(*domains, ",")[0])
+		url = scheme + domain
+		if port != "443" {
+			url = scheme + net.JoinHostPort(domain, port)
+		}
+	} else if host == "0.0.0.0" {
 		if ip := getLocalIP(); ip != "" {
-			url = "http://" + net.JoinHostPort(ip, port)
+			url = scheme + net.JoinHostPort(ip, port)
+		}
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return err
+	}
+
+	if *maxConns > 0 {
+		listener = newLimitListener(listener, *maxConns, tlsConfig == nil)
+	}
+
+	profile := networkProfiles[*network]
+	if *throttle != "" || *connThrottle != "" || profile.rate != 0 {
+		tl := throttledListener{Listener: listener, perConn: profile.rate}
+		if *throttle != "" {
+			limit, err := parseRate(*throttle)
+			if err != nil {
+				return err
+			}
+			tl.limiter = newRateLimiter(limit)
+		}
+		if *connThrottle != "" {
+			if tl.perConn, err = parseRate(*connThrottle); err != nil {
+				return err
+			}
+		}
+		listener = tl
+	}
+
+	if dash != nil {
+		if err := dash.start(url); err != nil {
+			return err
 		}
+		defer dash.close()
+	} else {
+		fmt.Fprintf(console, "\nServer started at %s\n\n", paint(useColor, "4", url))
 	}
 
-	fmt.Printf("\nServer started at \033[4m%s\033[0m\n\n", url)
+	if *configFile != "" {
+		go sites.watchConfig(os.Args[1:], 2*time.Second)
+	}
 
-	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+	if tlsConfig != nil {
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+	if err != http.ErrServerClosed {
 		return err
 	}
 
@@ -186,25 +861,62 @@ func run(root string) error {
 func main() {
 	flag.Usage = func() {
 		out := strings.Builder{}
-		out.WriteString("\nUsage:\n  serve [flags] [root]\n\nFlags:\n")
+		out.WriteString("\nUsage:\n  serve [flags] [root]\n  serve sign [flags] path\n  serve init [flags] [-- flags] [root]\n\nFlags:\n")
 
+		tw := tabwriter.NewWriter(&out, 0, 0, 4, ' ', 0)
 		flag.VisitAll(func(f *flag.Flag) {
-			out.WriteString("  -")
-			out.WriteString(f.Name)
-			out.WriteString("    ")
-			out.WriteString(f.Usage)
-			out.WriteString("\n")
+			fmt.Fprintf(tw, "  -%s\t%s\n", f.Name, f.Usage)
 		})
+		tw.Flush()
 
 		fmt.Println(out.String())
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "sign" {
+		if err := runSign(os.Args[2:]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "init" {
+		if err := runInit(os.Args[2:]); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.Parse()
-	args := flag.Args()
+	if !isFlagSet("config") {
+		*configFile = os.Getenv("SERVE_CONFIG")
+	}
 
-	root := "."
-	if len(args) != 0 {
-		root = args[0]
+	root, err := loadSettings(os.Args[1:])
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	useColor = colorEnabled()
+
+	if *printConfig {
+		if err := writeSettings(os.Stdout, root); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if *checkConfig {
+		if err := checkSettings(root); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if !*printConfig {
+			fmt.Println("Configuration OK")
+		}
+	}
+	if *printConfig || *checkConfig {
+		return
 	}
 
 	if err := run(root); err != nil {
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+var manage = flag.Bool("manage", false, "Expose a file management API under /_api/ (requires authentication)")
+
+type managementAPI struct {
+	settings *settings
+}
+
+func (api managementAPI) resolve(w http.ResponseWriter, name string) (string, string, bool) {
+	urlPath := path.Clean("/" + name)
+	if api.settings.isHiddenPath(urlPath) {
+		writeAPIError(w, http.StatusForbidden, "403 forbidden")
+		return "", "", false
+	}
+	return urlPath, filepath.Join(api.settings.root, filepath.FromSlash(urlPath)), true
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeAPIJSON(w, status, map[string]string{"error": msg})
+}
+
+func writeFileError(w http.ResponseWriter, err error) {
+	switch {
+	case os.IsNotExist(err):
+		writeAPIError(w, http.StatusNotFound, "404 not found")
+	case os.IsExist(err):
+		writeAPIError(w, http.StatusConflict, "409 file already exists")
+	case os.IsPermission(err):
+		writeAPIError(w, http.StatusForbidden, "403 forbidden")
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "500 "+err.Error())
+	}
+}
+
+func newJSONEntry(info os.FileInfo) jsonEntry {
+	e := jsonEntry{Name: info.Name(), Size: info.Size(), ModTime: info.ModTime(), Type: "file"}
+	if info.IsDir() {
+		e.Type = "dir"
+	}
+	return e
+}
+
+func (api managementAPI) list(w http.ResponseWriter, r *http.Request) {
+	_, name, ok := api.resolve(w, r.PathValue("path"))
+	if !ok {
+		return
+	}
+
+	files, err := os.ReadDir(name)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+
+	entries := []jsonEntry{}
+	for _, file := range files {
+		if api.settings.isHiddenPath(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, newJSONEntry(info))
+	}
+	writeAPIJSON(w, http.StatusOK, entries)
+}
+
+func (api managementAPI) stat(w http.ResponseWriter, r *http.Request) {
+	_, name, ok := api.resolve(w, r.PathValue("path"))
+	if !ok {
+		return
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, newJSONEntry(info))
+}
+
+func (api managementAPI) mkdir(w http.ResponseWriter, r *http.Request) {
+	_, name, ok := api.resolve(w, r.PathValue("path"))
+	if !ok {
+		return
+	}
+
+	if err := os.MkdirAll(name, 0o755); err != nil {
+		writeFileError(w, err)
+		return
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusCreated, newJSONEntry(info))
+}
+
+func (api managementAPI) delete(w http.ResponseWriter, r *http.Request) {
+	urlPath, name, ok := api.resolve(w, r.PathValue("path"))
+	if !ok {
+		return
+	}
+	if urlPath == "/" {
+		writeAPIError(w, http.StatusForbidden, "403 cannot delete the root")
+		return
+	}
+
+	if _, err := os.Lstat(name); err != nil {
+		writeFileError(w, err)
+		return
+	}
+
+	remove := os.Remove
+	if r.URL.Query().Has("recursive") {
+		remove = os.RemoveAll
+	}
+	if err := remove(name); err != nil {
+		if errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, os.ErrExist) {
+			writeAPIError(w, http.StatusConflict, "409 directory not empty")
+			return
+		}
+		writeFileError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api managementAPI) move(w http.ResponseWriter, r *http.Request) {
+	from, oldName, ok := api.resolve(w, r.PathValue("path"))
+	if !ok {
+		return
+	}
+	if !r.URL.Query().Has("to") {
+		writeAPIError(w, http.StatusBadRequest, "400 missing to parameter")
+		return
+	}
+	to, newName, ok := api.resolve(w, r.URL.Query().Get("to"))
+	if !ok {
+		return
+	}
+	if from == "/" || to == "/" || strings.HasPrefix(to, from+"/") {
+		writeAPIError(w, http.StatusBadRequest, "400 invalid move")
+		return
+	}
+
+	if _, err := os.Lstat(oldName); err != nil {
+		writeFileError(w, err)
+		return
+	}
+	if _, err := os.Lstat(newName); err == nil && !api.settings.overwrite {
+		writeAPIError(w, http.StatusConflict, "409 file already exists")
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(newName), 0o755); err != nil {
+		writeFileError(w, err)
+		return
+	}
+	if err := os.Rename(oldName, newName); err != nil {
+		writeFileError(w, err)
+		return
+	}
+
+	info, err := os.Stat(newName)
+	if err != nil {
+		writeFileError(w, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, newJSONEntry(info))
+}
+
+func withManageAPI(cfg *settings, h http.Handler) http.HandlerFunc {
+	api := managementAPI{cfg}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /_api/list/{path...}", api.list)
+	mux.HandleFunc("GET /_api/stat/{path...}", api.stat)
+	mux.HandleFunc("POST /_api/mkdir/{path...}", api.mkdir)
+	mux.HandleFunc("POST /_api/move/{path...}", api.move)
+	mux.HandleFunc("DELETE /_api/delete/{path...}", api.delete)
+	mux.HandleFunc("/_api/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "404 not found")
+	})
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/_api/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+var mediaKinds = map[string]string{
+	".mp3":  "audio",
+	".m4a":  "audio",
+	".aac":  "audio",
+	".ogg":  "audio",
+	".oga":  "audio",
+	".opus": "audio",
+	".flac": "audio",
+	".wav":  "audio",
+	".mp4":  "video",
+	".m4v":  "video",
+	".webm": "video",
+	".ogv":  "video",
+	".mov":  "video",
+}
+
+type mediaItem struct {
+	Name string
+	URL  string
+	Kind string
+}
+
+func mediaKind(name string) string {
+	return mediaKinds[strings.ToLower(path.Ext(name))]
+}
+
+func mediaPlaylist(entries []listingEntry) []mediaItem {
+	items := []mediaItem{}
+	files := 0
+	for _, entry := range entries {
+		if entry.IsDir {
+			continue
+		}
+		files++
+		if kind := mediaKind(entry.Name); kind != "" {
+			items = append(items, mediaItem{entry.Name, entry.URL, kind})
+		}
+	}
+
+	if len(items) == 0 || len(items)*2 < files {
+		return nil
+	}
+	return items
+}
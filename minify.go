@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+	"github.com/tdewolff/minify/v2/json"
+	"github.com/tdewolff/minify/v2/svg"
+)
+
+var minifyText = flag.Bool("minify", false, "Minify HTML, CSS, JavaScript, JSON and SVG responses")
+
+func newMinifier() *minify.M {
+	m := minify.New()
+	m.AddFunc("text/html", html.Minify)
+	m.AddFunc("text/css", css.Minify)
+	m.AddFunc("image/svg+xml", svg.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`^(application|text)/(x-)?(java|ecma)script$`), js.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`[/+]json$`), json.Minify)
+	return m
+}
+
+const minifyCacheLimit = 64 << 20
+
+type minifyCache struct {
+	m       *minify.M
+	entries *lruCache[string, []byte]
+}
+
+func (c *minifyCache) minify(key, mediaType string, data []byte) []byte {
+	if key != "" {
+		if cached, ok := c.entries.get(key); ok {
+			return cached
+		}
+	}
+
+	minified, err := c.m.Bytes(mediaType, data)
+	if err != nil {
+		return data
+	}
+
+	if key != "" {
+		c.entries.add(key, minified)
+	}
+	return minified
+}
+
+type minifyResponseWriter struct {
+	http.ResponseWriter
+	r         *http.Request
+	cache     *minifyCache
+	mediaType string
+	status    int
+	buf       *bytes.Buffer
+}
+
+func (w *minifyResponseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+
+	h := w.Header()
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if status != http.StatusOK || h.Get("Content-Encoding") != "" {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if _, _, fn := w.cache.m.Match(mediaType); fn == nil {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.mediaType = mediaType
+	w.buf = &bytes.Buffer{}
+}
+
+func (w *minifyResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buf != nil {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *minifyResponseWriter) finish() {
+	if w.buf == nil {
+		return
+	}
+
+	h := w.Header()
+	if w.r.Method == http.MethodHead {
+		h.Del("Content-Length")
+		weakenETag(h)
+		w.ResponseWriter.WriteHeader(w.status)
+		return
+	}
+
+	key := ""
+	if modTime := h.Get("Last-Modified"); modTime != "" {
+		key = w.r.URL.Path + "\x00" + modTime + "\x00" + strconv.Itoa(w.buf.Len())
+	}
+
+	data := w.cache.minify(key, w.mediaType, w.buf.Bytes())
+	weakenETag(h)
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(data)
+}
+
+func withMinify(h http.Handler) http.HandlerFunc {
+	cache := &minifyCache{
+		m:       newMinifier(),
+		entries: newLRUCache[string, []byte](minifyCacheLimit, func(data []byte) int64 { return int64(len(data)) }),
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		mw := &minifyResponseWriter{ResponseWriter: w, r: r, cache: cache}
+		h.ServeHTTP(mw, r)
+		mw.finish()
+	}
+}
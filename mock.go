@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var mockDir = flag.String("mock", "", "Answer API requests from fixture files in `dir`, such as api/users.GET.json for GET /api/users (see Mock APIs in the README)")
+
+type mockResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+	Latency string            `json:"latency"`
+
+	delay time.Duration
+}
+
+func splitMockName(name string) (base, method string, ok bool) {
+	ext := filepath.Ext(name)
+	base = strings.TrimSuffix(name, ext)
+	method = strings.TrimPrefix(filepath.Ext(base), ".")
+	base = strings.TrimSuffix(base, "."+method)
+	if method == "" || base == "" || strings.HasPrefix(name, ".") || strings.Trim(method, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", "", false
+	}
+	return base, method, true
+}
+
+func isMockParam(name string) bool {
+	return len(name) > 2 && strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]")
+}
+
+func findMock(dir string, segments []string, method string) (string, []string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", nil
+	}
+
+	for _, param := range []bool{false, true} {
+		if len(segments) > 1 {
+			for _, entry := range entries {
+				if !entry.IsDir() || (param && !isMockParam(entry.Name())) || (!param && entry.Name() != segments[0]) {
+					continue
+				}
+				if file, methods := findMock(filepath.Join(dir, entry.Name()), segments[1:], method); file != "" || len(methods) != 0 {
+					return file, methods
+				}
+			}
+			continue
+		}
+
+		file, methods := "", []string{}
+		for _, entry := range entries {
+			base, m, ok := splitMockName(entry.Name())
+			if !ok || entry.IsDir() || (param && !isMockParam(base)) || (!param && base != segments[0]) {
+				continue
+			}
+			if m == method && file == "" {
+				file = filepath.Join(dir, entry.Name())
+			}
+			methods = append(methods, m)
+		}
+		if file != "" || len(methods) != 0 {
+			return file, methods
+		}
+	}
+	return "", nil
+}
+
+func parseMock(name string) (mockResponse, []byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return mockResponse{}, nil, err
+	}
+
+	mock := mockResponse{Status: http.StatusOK, Headers: map[string]string{}}
+	if filepath.Ext(name) != ".json" {
+		mock.Headers["Content-Type"] = mime.TypeByExtension(filepath.Ext(name))
+		return mock, data, nil
+	}
+
+	fields := map[string]json.RawMessage{}
+	if json.Unmarshal(data, &fields) == nil && isMockEnvelope(fields) {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&mock); err != nil {
+			return mockResponse{}, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if mock.Status == 0 {
+			mock.Status = http.StatusOK
+		}
+		if mock.Headers == nil {
+			mock.Headers = map[string]string{}
+		}
+		if mock.Latency != "" {
+			if mock.delay, err = time.ParseDuration(mock.Latency); err != nil {
+				return mockResponse{}, nil, fmt.Errorf("%s: invalid latency %q", name, mock.Latency)
+			}
+		}
+		data = mock.Body
+	}
+
+	contentType := "application/json"
+	var text string
+	if json.Unmarshal(data, &text) == nil {
+		data, contentType = []byte(text), "text/plain; charset=utf-8"
+	}
+	if _, ok := mock.Headers["Content-Type"]; !ok && len(data) != 0 {
+		mock.Headers["Content-Type"] = contentType
+	}
+	return mock, data, nil
+}
+
+func isMockEnvelope(fields map[string]json.RawMessage) bool {
+	_, hasStatus := fields["status"]
+	_, hasBody := fields["body"]
+	if !hasStatus && !hasBody {
+		return false
+	}
+	for name := range fields {
+		if name != "status" && name != "headers" && name != "body" && name != "latency" {
+			return false
+		}
+	}
+	return true
+}
+
+func withMocks(cfg *settings, dir string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+		if cfg.isHiddenPath(urlPath) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		segments := strings.Split(strings.TrimPrefix(urlPath, "/"), "/")
+		if segments[len(segments)-1] == "" {
+			segments[len(segments)-1] = "index"
+		}
+
+		method := r.Method
+		file, methods := findMock(dir, segments, method)
+		if file == "" && method == http.MethodHead {
+			method = http.MethodGet
+			file, methods = findMock(dir, segments, method)
+		}
+		if file == "" && len(methods) == 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if file == "" {
+			sort.Strings(methods)
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		mock, body, err := parseMock(file)
+		if err != nil {
+			fmt.Fprintln(errorLog, "Error reading mock:", err)
+			http.Error(w, "500 invalid mock "+filepath.Base(file), http.StatusInternalServerError)
+			return
+		}
+		debugf(r, "mocked %s %s with %s", r.Method, urlPath, file)
+
+		if mock.delay > 0 {
+			select {
+			case <-time.After(mock.delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		for name, value := range mock.Headers {
+			w.Header().Set(name, value)
+		}
+		w.WriteHeader(mock.Status)
+		w.Write(body)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+var (
+	oidcIssuer       = flag.String("oidc-issuer", "", "Require browser login through the OpenID Connect provider at `url`")
+	oidcClientID     = flag.String("oidc-client-id", "", "Set the OpenID Connect client `id` (requires -oidc-issuer)")
+	oidcClientSecret = flag.String("oidc-client-secret", "", "Set the OpenID Connect client `secret` (requires -oidc-issuer)")
+	oidcRedirectURL  = flag.String("oidc-redirect-url", "", "Set the OpenID Connect callback `url` (default: /_oidc/callback on the requested host)")
+
+	oidcAllow listFlag
+)
+
+func init() {
+	flag.Var(&oidcAllow, "oidc-allow", "Only let in OpenID Connect users whose subject, verified email or @domain matches `value` (repeatable, required for -manage, -dashboard and -analytics)")
+}
+
+var oidcSecret = sync.OnceValues(func() ([]byte, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	return secret, err
+})
+
+const (
+	oidcCallbackPath = "/_oidc/callback"
+	oidcSessionName  = "serve_session"
+	oidcStateName    = "serve_oidc_state"
+	oidcSessionTTL   = 24 * time.Hour
+)
+
+type oidcProvider struct {
+	config oauth2.Config
+	parser *jwt.Parser
+	jwks   *jwksCache
+	secret []byte
+	allow  []string
+}
+
+func newOIDCProvider() (*oidcProvider, error) {
+	if *oidcClientID == "" {
+		return nil, errors.New("-oidc-issuer requires -oidc-client-id")
+	}
+
+	issuer := strings.TrimSuffix(*oidcIssuer, "/")
+	res, err := jwksClient.Get(issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching OpenID configuration for %s: %s", issuer, res.Status)
+	}
+
+	discovery := struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&discovery); err != nil {
+		return nil, err
+	}
+
+	jwks := &jwksCache{url: discovery.JWKSURI, fetchedAt: time.Now()}
+	if err := jwks.fetch(); err != nil {
+		return nil, err
+	}
+
+	secret, err := oidcSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	return &oidcProvider{
+		config: oauth2.Config{
+			ClientID:     *oidcClientID,
+			ClientSecret: *oidcClientSecret,
+			RedirectURL:  *oidcRedirectURL,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  discovery.AuthorizationEndpoint,
+				TokenURL: discovery.TokenEndpoint,
+			},
+			Scopes: []string{"openid", "profile", "email"},
+		},
+		parser: jwt.NewParser(
+			jwt.WithIssuer(discovery.Issuer),
+			jwt.WithAudience(*oidcClientID),
+			jwt.WithExpirationRequired(),
+		),
+		jwks:   jwks,
+		secret: secret,
+		allow:  append([]string{}, oidcAllow...),
+	}, nil
+}
+
+func (p *oidcProvider) allowed(subject, email string) bool {
+	if len(p.allow) == 0 {
+		return true
+	}
+
+	email = strings.ToLower(email)
+	for _, value := range p.allow {
+		switch {
+		case strings.HasPrefix(value, "@"):
+			if email != "" && strings.HasSuffix(email, strings.ToLower(value)) {
+				return true
+			}
+		case strings.Contains(value, "@"):
+			if email != "" && email == strings.ToLower(value) {
+				return true
+			}
+		case value == subject:
+			return true
+		}
+	}
+	return false
+}
+
+func (p *oidcProvider) sign(value string) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(value))
+	return value + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (p *oidcProvider) verify(signed string) (string, bool) {
+	i := strings.LastIndex(signed, ".")
+	if i < 0 {
+		return "", false
+	}
+	value := signed[:i]
+	return value, hmac.Equal([]byte(signed), []byte(p.sign(value)))
+}
+
+func (p *oidcProvider) session(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(oidcSessionName)
+	if err != nil {
+		return "", false
+	}
+
+	value, ok := p.verify(cookie.Value)
+	if !ok {
+		return "", false
+	}
+
+	fields := strings.Split(value, "|")
+	if len(fields) != 3 {
+		return "", false
+	}
+	unix, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || time.Now().Unix() >= unix {
+		return "", false
+	}
+
+	subject, _ := base64.RawURLEncoding.DecodeString(fields[0])
+	email, _ := base64.RawURLEncoding.DecodeString(fields[1])
+	if !p.allowed(string(subject), string(email)) {
+		return "", false
+	}
+	return string(subject), true
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (p *oidcProvider) redirectURL(r *http.Request) string {
+	if p.config.RedirectURL != "" {
+		return p.config.RedirectURL
+	}
+
+	scheme := "http://"
+	if r.TLS != nil {
+		scheme = "https://"
+	}
+	return scheme + r.Host + oidcCallbackPath
+}
+
+func (p *oidcProvider) login(w http.ResponseWriter, r *http.Request) {
+	state, nonce := randomToken(), randomToken()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateName,
+		Value:    p.sign(state + "|" + nonce + "|" + base64.RawURLEncoding.EncodeToString([]byte(r.URL.RequestURI()))),
+		Path:     "/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	config := p.config
+	config.RedirectURL = p.redirectURL(r)
+	http.Redirect(w, r, config.AuthCodeURL(state, oauth2.SetAuthURLParam("nonce", nonce)), http.StatusFound)
+}
+
+func (p *oidcProvider) callback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(oidcStateName)
+	if err != nil {
+		http.Error(w, "400 missing login state", http.StatusBadRequest)
+		return
+	}
+
+	value, ok := p.verify(cookie.Value)
+	fields := strings.Split(value, "|")
+	if !ok || len(fields) != 3 || fields[0] != r.URL.Query().Get("state") {
+		http.Error(w, "400 invalid login state", http.StatusBadRequest)
+		return
+	}
+
+	config := p.config
+	config.RedirectURL = p.redirectURL(r)
+	token, err := config.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		http.Error(w, "401 login failed", http.StatusUnauthorized)
+		return
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	idToken, err := p.parser.Parse(rawIDToken, p.jwks.key)
+	if err != nil {
+		http.Error(w, "401 invalid ID token", http.StatusUnauthorized)
+		return
+	}
+	claims, _ := idToken.Claims.(jwt.MapClaims)
+	if nonce, _ := claims["nonce"].(string); nonce == "" || nonce != fields[1] {
+		http.Error(w, "401 invalid ID token nonce", http.StatusUnauthorized)
+		return
+	}
+
+	subject, _ := claims.GetSubject()
+	email, _ := claims["email"].(string)
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		email = ""
+	}
+	if !p.allowed(subject, email) {
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+
+	expires := time.Now().Add(oidcSessionTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name: oidcSessionName,
+		Value: p.sign(base64.RawURLEncoding.EncodeToString([]byte(subject)) + "|" +
+			base64.RawURLEncoding.EncodeToString([]byte(email)) + "|" + strconv.FormatInt(expires.Unix(), 10)),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{Name: oidcStateName, Path: "/", MaxAge: -1})
+
+	target := "/"
+	if b, err := base64.RawURLEncoding.DecodeString(fields[2]); err == nil && strings.HasPrefix(string(b), "/") && !strings.HasPrefix(string(b), "//") {
+		target = string(b)
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func withOIDC(p *oidcProvider, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == oidcCallbackPath {
+			p.callback(w, r)
+			return
+		}
+
+		subject, ok := p.session(r)
+		if !ok {
+			p.login(w, r)
+			return
+		}
+
+		h.ServeHTTP(w, withUser(r, subject))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var (
+	trailingSlash = flag.String("trailing-slash", "", "Set the trailing slash `policy` for pages: redirect-add, redirect-strip or ignore")
+	cleanURLs     = flag.String("clean-urls", "on", "Set the clean URL `mode` for .html files: off, on or redirect")
+)
+
+func withTrailingSlash(fs http.FileSystem, policy string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlPath := r.URL.Path
+		name := path.Clean("/" + urlPath)
+		if name == "/" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		file, err := fs.Open(name)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		stat, err := file.Stat()
+		file.Close()
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		isPage := stat.IsDir() || stat.Name() != path.Base(name)
+		hasSlash := strings.HasSuffix(urlPath, "/")
+
+		want := hasSlash
+		switch policy {
+		case "redirect-add":
+			want = isPage
+		case "redirect-strip":
+			want = false
+		}
+
+		if want != hasSlash {
+			debugf(r, "redirecting for -trailing-slash %s", policy)
+			target := name
+			if want {
+				target += "/"
+			}
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+
+		r = r.Clone(r.Context())
+		r.URL.Path = name
+		if stat.IsDir() {
+			r.URL.Path += "/"
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
+
+func validateTrailingSlash(policy string) error {
+	switch policy {
+	case "", "redirect-add", "redirect-strip", "ignore":
+		return nil
+	}
+	return fmt.Errorf("invalid trailing slash policy %q", policy)
+}
+
+func withCleanURLRedirects(fs http.FileSystem, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		if path.Ext(name) != ".html" || path.Base(name) == "index.html" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		file, err := fs.Open(name)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		file.Close()
+		debugf(r, "redirecting to the clean URL for %s", name)
+
+		target := strings.TrimSuffix(name, ".html")
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
+
+func validateCleanURLs(mode string) error {
+	switch mode {
+	case "off", "on", "redirect":
+		return nil
+	}
+	return fmt.Errorf("invalid clean URL mode %q", mode)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"expvar"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+var debugAddr = flag.String("debug-addr", "", "Serve pprof profiles and expvar metrics at /debug/ on the loopback `host:port` or `port`")
+
+func init() {
+	expvar.Publish("traffic", expvar.Func(func() any {
+		snap := traffic.snapshot(0)
+		return map[string]any{
+			"requests": snap.Requests,
+			"bytes":    snap.Bytes,
+			"statuses": snap.Statuses,
+			"latency":  snap.Latency,
+		}
+	}))
+}
+
+func newDebugServer(addr string) (*http.Server, error) {
+	host, port, err := splitAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("-debug-addr must be a loopback address such as localhost:6060, not %q", addr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return &http.Server{Addr: net.JoinHostPort(host, port), Handler: mux}, nil
+}
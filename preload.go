@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var preload = flag.Bool("preload", false, "Read and compress text assets into memory at startup and serve them from there")
+
+type preloadedFile struct {
+	name        string
+	modTime     time.Time
+	contentType string
+	variants    map[string][]byte
+}
+
+type preloadCache map[string]*preloadedFile
+
+func buildPreloadCache(cfg *settings, encodings []string) (preloadCache, error) {
+	root := cfg.root
+	cache := preloadCache{}
+	dirs := []string{}
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !cfg.hiddenFiles && name != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		urlPath := path.Clean("/" + filepath.ToSlash(rel))
+
+		if d.IsDir() {
+			if urlPath != "/" {
+				urlPath += "/"
+			}
+			dirs = append(dirs, urlPath)
+			return nil
+		}
+
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if !isCompressible(contentType) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		file := &preloadedFile{
+			name:        urlPath,
+			modTime:     info.ModTime(),
+			contentType: contentType,
+			variants:    map[string][]byte{"": data},
+		}
+
+		for _, encoding := range encodings {
+			buf := bytes.Buffer{}
+			enc := encoders[encoding](&buf, cfg.brotliLevel)
+			if _, err := enc.Write(data); err != nil {
+				return err
+			}
+			if err := enc.Close(); err != nil {
+				return err
+			}
+			if buf.Len() < len(data) {
+				file.variants[encoding] = buf.Bytes()
+			}
+		}
+
+		cache[urlPath] = file
+		if cfg.cleanURLs != "off" && path.Ext(urlPath) == ".html" {
+			clean := strings.TrimSuffix(urlPath, ".html")
+			if _, err := os.Stat(strings.TrimSuffix(name, ".html")); os.IsNotExist(err) {
+				cache[clean] = file
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		for _, index := range cfg.indexFiles {
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(dir), index)); err == nil {
+				if file, ok := cache[dir+index]; ok {
+					cache[dir] = file
+				}
+				break
+			}
+		}
+	}
+
+	for urlPath := range cache {
+		if strings.HasSuffix(urlPath, "/index.html") {
+			delete(cache, urlPath)
+		}
+	}
+
+	return cache, nil
+}
+
+func withPreload(cache preloadCache, encodings []string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		file, ok := cache[r.URL.Path]
+		if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		data := file.variants[""]
+		for _, encoding := range acceptedEncodings(r, encodings) {
+			if variant, ok := file.variants[encoding]; ok {
+				w.Header().Set("Content-Encoding", encoding)
+				data = variant
+				break
+			}
+		}
+
+		w.Header().Set("Content-Type", file.contentType)
+		addVary(w.Header(), "Accept-Encoding")
+		http.ServeContent(w, r, file.name, file.modTime, bytes.NewReader(data))
+	}
+}
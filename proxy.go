@@ -0,0 +1,348 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var proxyRules listFlag
+
+func init() {
+	flag.Var(&proxyRules, "proxy", "Proxy requests to a backend by path prefix, host or regex with a `rule` such as /api=http://localhost:3000 (repeatable, see Proxying in the README)")
+}
+
+type upstream struct {
+	url     *url.URL
+	proxy   *httputil.ReverseProxy
+	healthy atomic.Bool
+	active  atomic.Int64
+}
+
+type proxyRule struct {
+	spec            string
+	host            string
+	prefix          string
+	pattern         *regexp.Regexp
+	upstreams       []*upstream
+	strip           bool
+	keepHost        bool
+	requestHeaders  http.Header
+	responseHeaders http.Header
+	leastConns      bool
+	next            atomic.Uint64
+	healthPath      string
+	healthInterval  time.Duration
+	stopHealth      chan struct{}
+	cache           *proxyCache
+}
+
+func (rule *proxyRule) matches(r *http.Request, urlPath string) bool {
+	if rule.host != "" {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if !strings.EqualFold(host, rule.host) {
+			return false
+		}
+	}
+
+	if rule.pattern != nil {
+		return rule.pattern.MatchString(urlPath)
+	}
+	return rule.prefix == "/" || urlPath == rule.prefix || strings.HasPrefix(urlPath, rule.prefix+"/")
+}
+
+func (rule *proxyRule) beats(other *proxyRule) bool {
+	if other == nil {
+		return true
+	}
+	if (rule.host != "") != (other.host != "") {
+		return rule.host != ""
+	}
+	return len(rule.prefix) > len(other.prefix)
+}
+
+func (rule *proxyRule) stripPath(urlPath string) string {
+	if rule.pattern != nil {
+		if loc := rule.pattern.FindStringIndex(urlPath); loc != nil {
+			urlPath = urlPath[:loc[0]] + urlPath[loc[1]:]
+		}
+	} else if rule.prefix != "/" {
+		urlPath = strings.TrimPrefix(urlPath, rule.prefix)
+	}
+
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+	return urlPath
+}
+
+func (rule *proxyRule) pick() *upstream {
+	healthy := make([]*upstream, 0, len(rule.upstreams))
+	for _, u := range rule.upstreams {
+		if u.healthy.Load() {
+			healthy = append(healthy, u)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	start := int((rule.next.Add(1) - 1) % uint64(len(healthy)))
+	if !rule.leastConns {
+		return healthy[start]
+	}
+
+	best := healthy[start]
+	for i := range healthy {
+		if u := healthy[(start+i)%len(healthy)]; u.active.Load() < best.active.Load() {
+			best = u
+		}
+	}
+	return best
+}
+
+func (rule *proxyRule) watchHealth() {
+	ticker := time.NewTicker(rule.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, u := range rule.upstreams {
+			go u.checkHealth(rule.healthPath, rule.healthInterval)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-rule.stopHealth:
+			return
+		}
+	}
+}
+
+func (rule *proxyRule) Close() error {
+	if rule.stopHealth != nil {
+		close(rule.stopHealth)
+	}
+	return nil
+}
+
+func (u *upstream) checkHealth(healthPath string, timeout time.Duration) {
+	client := http.Client{
+		Timeout: min(timeout, 5*time.Second),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, err := client.Get(u.url.JoinPath(healthPath).String())
+	if err == nil {
+		res.Body.Close()
+		if res.StatusCode >= 400 {
+			err = fmt.Errorf("status %d", res.StatusCode)
+		}
+	}
+	u.setHealthy(err)
+}
+
+func (u *upstream) setHealthy(err error) {
+	if err == nil {
+		u.healthy.Store(true)
+	} else if u.healthy.Swap(false) {
+		fmt.Fprintf(errorLog, "Proxy backend %s is unhealthy: %v\n", u.url, err)
+	}
+}
+
+func setHeaders(header, values http.Header) {
+	for name, value := range values {
+		if value[0] == "" {
+			header.Del(name)
+		} else {
+			header[name] = value
+		}
+	}
+}
+
+func parseProxyRule(value string) (*proxyRule, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid proxy rule %q", value)
+	}
+
+	match, target, ok := strings.Cut(fields[0], "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid proxy rule %q", value)
+	}
+
+	rule := &proxyRule{
+		spec:            match,
+		healthInterval:  10 * time.Second,
+		requestHeaders:  http.Header{},
+		responseHeaders: http.Header{},
+	}
+
+	if pattern, ok := strings.CutPrefix(match, "~"); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy pattern %q: %v", pattern, err)
+		}
+		rule.pattern = re
+	} else {
+		rule.prefix = match
+		if !strings.HasPrefix(match, "/") {
+			rule.host, rule.prefix, _ = strings.Cut(match, "/")
+			rule.prefix = "/" + rule.prefix
+		}
+		if rule.host == "" && !strings.HasPrefix(match, "/") {
+			return nil, fmt.Errorf("invalid proxy rule %q", value)
+		}
+		rule.prefix = path.Clean(rule.prefix)
+	}
+
+	for _, target := range strings.Split(target, ",") {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy target %q", target)
+		}
+		rule.upstreams = append(rule.upstreams, &upstream{url: u})
+	}
+
+	for _, option := range fields[1:] {
+		name, arg, _ := strings.Cut(option, "=")
+		switch name {
+		case "strip":
+			rule.strip = true
+		case "keep-host":
+			rule.keepHost = true
+		case "cache":
+			cache, err := newProxyCache()
+			if err != nil {
+				return nil, err
+			}
+			rule.cache = cache
+		case "balance":
+			if arg != "round-robin" && arg != "least-conn" {
+				return nil, fmt.Errorf("unknown proxy balancing %q", arg)
+			}
+			rule.leastConns = arg == "least-conn"
+		case "health":
+			rule.healthPath = "/" + strings.TrimPrefix(arg, "/")
+		case "health-interval":
+			interval, err := time.ParseDuration(arg)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("invalid proxy health interval %q", arg)
+			}
+			rule.healthInterval = interval
+		case "request-header", "response-header":
+			header, headerValue, ok := strings.Cut(arg, ":")
+			if !ok || strings.TrimSpace(header) == "" {
+				return nil, fmt.Errorf("invalid proxy header %q", arg)
+			}
+			headers := rule.requestHeaders
+			if name == "response-header" {
+				headers = rule.responseHeaders
+			}
+			headers[http.CanonicalHeaderKey(strings.TrimSpace(header))] = []string{strings.TrimSpace(headerValue)}
+		default:
+			return nil, fmt.Errorf("unknown proxy option %q", option)
+		}
+	}
+
+	for _, u := range rule.upstreams {
+		u.proxy = newReverseProxy(rule, u)
+		u.healthy.Store(true)
+	}
+	if rule.healthPath != "" {
+		rule.stopHealth = make(chan struct{})
+	}
+	return rule, nil
+}
+
+func parseProxyRules(values []string) ([]*proxyRule, error) {
+	rules := []*proxyRule{}
+	for _, value := range values {
+		rule, err := parseProxyRule(value)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func newReverseProxy(rule *proxyRule, u *upstream) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if rule.strip {
+				pr.Out.URL.Path = rule.stripPath(pr.In.URL.Path)
+				pr.Out.URL.RawPath = ""
+			}
+			pr.SetURL(u.url)
+			pr.SetXForwarded()
+			if rule.keepHost || pr.In.Header.Get("Upgrade") != "" {
+				pr.Out.Host = pr.In.Host
+			}
+			setHeaders(pr.Out.Header, rule.requestHeaders)
+		},
+		ModifyResponse: func(res *http.Response) error {
+			setHeaders(res.Header, rule.responseHeaders)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Fprintf(errorLog, "Error proxying %s to %s: %v\n", r.URL.Path, u.url, err)
+			if rule.healthPath != "" && r.Context().Err() == nil {
+				u.setHealthy(err)
+			}
+			http.Error(w, "502 bad gateway", http.StatusBadGateway)
+		},
+	}
+}
+
+func withProxy(rules []*proxyRule, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+
+		var match *proxyRule
+		for _, rule := range rules {
+			if !rule.matches(r, urlPath) {
+				continue
+			}
+			if rule.pattern != nil {
+				match = rule
+				break
+			}
+			if rule.beats(match) {
+				match = rule
+			}
+		}
+		if match == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		u := match.pick()
+		if u == nil {
+			debugf(r, "no healthy backends for -proxy %s", match.spec)
+			http.Error(w, "503 no healthy backends", http.StatusServiceUnavailable)
+			return
+		}
+
+		debugf(r, "proxying %s to %s (-proxy %s)", r.URL.Path, u.url, match.spec)
+		u.active.Add(1)
+		defer u.active.Add(-1)
+		if match.cache != nil && cacheable(r) {
+			match.cache.serve(w, r, match, u)
+			return
+		}
+		u.proxy.ServeHTTP(w, r)
+	}
+}
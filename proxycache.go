@@ -0,0 +1,415 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	proxyCacheDir  = flag.String("proxy-cache", "", "Store responses for -proxy rules with the cache option in `dir` (default: user cache directory)")
+	proxyCacheSize = flag.String("proxy-cache-size", "1GB", "Evict the least recently used -proxy-cache responses beyond `size` in bytes, such as 500MB")
+)
+
+type proxyCache struct {
+	dir     string
+	maxSize int64
+}
+
+var proxyCacheEviction sync.Mutex
+
+type cacheEntry struct {
+	URL      string        `json:"url"`
+	Header   http.Header   `json:"header"`
+	Stored   time.Time     `json:"stored"`
+	Lifetime time.Duration `json:"lifetime"`
+}
+
+func newProxyCache() (*proxyCache, error) {
+	dir := *proxyCacheDir
+	if dir == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(cacheDir, "serve", "proxy")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	maxSize, err := parseSize(*proxyCacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyCache{dir, int64(maxSize)}, nil
+}
+
+func (c *proxyCache) key(rule *proxyRule, r *http.Request) string {
+	id := rule.spec + "\x00" + r.URL.RequestURI()
+	if rule.keepHost || rule.host != "" {
+		id += "\x00" + strings.ToLower(r.Host)
+	}
+	hash := sha256.Sum256([]byte(id))
+	return filepath.Join(c.dir, hex.EncodeToString(hash[:]))
+}
+
+func (c *proxyCache) load(key string) (*cacheEntry, *os.File) {
+	data, err := os.ReadFile(key + ".json")
+	if err != nil {
+		return nil, nil
+	}
+	entry := &cacheEntry{}
+	if json.Unmarshal(data, entry) != nil {
+		return nil, nil
+	}
+
+	body, err := os.Open(key + ".body")
+	if err != nil {
+		return nil, nil
+	}
+	if stat, err := body.Stat(); err != nil || entry.Header.Get("Content-Length") != "" && entry.Header.Get("Content-Length") != strconv.FormatInt(stat.Size(), 10) {
+		body.Close()
+		return nil, nil
+	}
+	return entry, body
+}
+
+func (c *proxyCache) save(key string, entry *cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp := key + ".json.tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, key+".json")
+}
+
+func (c *proxyCache) touch(key string) {
+	now := time.Now()
+	os.Chtimes(key+".json", now, now)
+}
+
+func (c *proxyCache) evict() {
+	if !proxyCacheEviction.TryLock() {
+		return
+	}
+	defer proxyCacheEviction.Unlock()
+
+	bodies, err := filepath.Glob(filepath.Join(c.dir, "*.body"))
+	if err != nil {
+		return
+	}
+
+	type cached struct {
+		key  string
+		size int64
+		used time.Time
+	}
+	entries := []cached{}
+	total := int64(0)
+	for _, body := range bodies {
+		stat, err := os.Stat(body)
+		if err != nil {
+			continue
+		}
+		key := strings.TrimSuffix(body, ".body")
+		used := stat.ModTime()
+		if meta, err := os.Stat(key + ".json"); err == nil {
+			used = meta.ModTime()
+		}
+		entries = append(entries, cached{key, stat.Size(), used})
+		total += stat.Size()
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+	for _, entry := range entries {
+		if total <= c.maxSize {
+			break
+		}
+		os.Remove(entry.key + ".json")
+		os.Remove(entry.key + ".body")
+		total -= entry.size
+	}
+}
+
+func (e *cacheEntry) fresh(r *http.Request) bool {
+	control := parseCacheControl(r.Header.Get("Cache-Control"))
+	if _, ok := control["no-cache"]; ok || control["max-age"] == "0" || r.Header.Get("Pragma") == "no-cache" {
+		return false
+	}
+	return time.Since(e.Stored) < e.Lifetime
+}
+
+func parseCacheControl(value string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(value, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+func sharedWithAuthorization(header http.Header) bool {
+	control := parseCacheControl(header.Get("Cache-Control"))
+	for _, name := range []string{"public", "s-maxage", "must-revalidate"} {
+		if _, ok := control[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func cacheLifetime(header http.Header) (time.Duration, bool) {
+	control := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := control["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := control["private"]; ok {
+		return 0, false
+	}
+	if header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	for _, vary := range strings.Split(header.Get("Vary"), ",") {
+		if vary = strings.TrimSpace(vary); vary != "" && !strings.EqualFold(vary, "Accept-Encoding") {
+			return 0, false
+		}
+	}
+
+	if _, ok := control["no-cache"]; ok {
+		return 0, true
+	}
+
+	age, _ := strconv.Atoi(header.Get("Age"))
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := control[name]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil {
+				return 0, true
+			}
+			return time.Duration(seconds-age) * time.Second, true
+		}
+	}
+
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		date = time.Now()
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0, true
+		}
+		return t.Sub(date), true
+	}
+	if modified, err := http.ParseTime(header.Get("Last-Modified")); err == nil && modified.Before(date) {
+		return min(date.Sub(modified)/10, 24*time.Hour), true
+	}
+	return 0, true
+}
+
+func serveCached(w http.ResponseWriter, r *http.Request, entry *cacheEntry, body *os.File, status string) {
+	defer body.Close()
+
+	for name, values := range entry.Header {
+		if name != "Content-Length" {
+			w.Header()[name] = values
+		}
+	}
+	w.Header().Set("Age", strconv.Itoa(int(time.Since(entry.Stored).Seconds())))
+	w.Header().Set("X-Cache", status)
+
+	modified, _ := http.ParseTime(entry.Header.Get("Last-Modified"))
+	http.ServeContent(w, r, "", modified, body)
+}
+
+type cacheResponseWriter struct {
+	http.ResponseWriter
+	header     http.Header
+	stale      bool
+	authorized bool
+	dir        string
+	mode       string
+	file       *os.File
+	written    int64
+	failed     bool
+}
+
+func (w *cacheResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *cacheResponseWriter) WriteHeader(status int) {
+	if w.mode != "" {
+		return
+	}
+
+	switch {
+	case status == http.StatusNotModified && w.stale:
+		w.mode = "revalidated"
+		return
+	case status >= 500 && w.stale:
+		w.mode = "stale"
+		return
+	}
+
+	w.mode = "pass"
+	if _, ok := cacheLifetime(w.header); ok && status == http.StatusOK && (!w.authorized || sharedWithAuthorization(w.header)) {
+		if file, err := os.CreateTemp(w.dir, "*.tmp"); err == nil {
+			w.mode, w.file = "store", file
+		}
+	}
+
+	for name, values := range w.header {
+		for _, value := range values {
+			w.ResponseWriter.Header().Add(name, value)
+		}
+	}
+	if w.mode == "store" {
+		w.ResponseWriter.Header().Set("X-Cache", "MISS")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheResponseWriter) Write(p []byte) (int, error) {
+	if w.mode == "" {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.mode == "revalidated" || w.mode == "stale" {
+		return len(p), nil
+	}
+
+	if w.file != nil {
+		if _, err := w.file.Write(p); err != nil {
+			w.failed = true
+		}
+		w.written += int64(len(p))
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *cacheResponseWriter) FlushError() error {
+	if w.mode == "revalidated" || w.mode == "stale" {
+		return nil
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *cacheResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func cacheable(r *http.Request) bool {
+	return (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		(r.Header.Get("Authorization") == "" || ownCredential(r)) &&
+		r.Header.Get("Cookie") == "" && r.Header.Get("Upgrade") == "" &&
+		!strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+func (c *proxyCache) serve(w http.ResponseWriter, r *http.Request, rule *proxyRule, u *upstream) {
+	key := c.key(rule, r)
+	entry, body := c.load(key)
+	if entry != nil && entry.fresh(r) {
+		debugf(r, "serving %s from the proxy cache", r.URL.Path)
+		c.touch(key)
+		serveCached(w, r, entry, body, "HIT")
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.Method = http.MethodGet
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Range", "Range", "Accept-Encoding"} {
+		out.Header.Del(name)
+	}
+	if entry != nil {
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			out.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.Header.Get("Last-Modified"); modified != "" {
+			out.Header.Set("If-Modified-Since", modified)
+		}
+	}
+
+	cw := &cacheResponseWriter{
+		ResponseWriter: w,
+		header:         http.Header{},
+		stale:          entry != nil,
+		authorized:     r.Header.Get("Authorization") != "",
+		dir:            c.dir,
+	}
+	defer func() {
+		if cw.file != nil {
+			cw.file.Close()
+			os.Remove(cw.file.Name())
+		}
+	}()
+	u.proxy.ServeHTTP(cw, out)
+
+	switch cw.mode {
+	case "revalidated":
+		debugf(r, "revalidated %s in the proxy cache", r.URL.Path)
+		for name, values := range cw.header {
+			if name != "Content-Length" {
+				entry.Header[name] = values
+			}
+		}
+		if lifetime, ok := cacheLifetime(entry.Header); ok {
+			entry.Lifetime = lifetime
+		}
+		entry.Stored = time.Now()
+		if err := c.save(key, entry); err != nil {
+			fmt.Fprintln(errorLog, "Error updating proxy cache:", err)
+		}
+		serveCached(w, r, entry, body, "REVALIDATED")
+	case "stale":
+		debugf(r, "backend failed, serving a stale copy of %s from the proxy cache", r.URL.Path)
+		serveCached(w, r, entry, body, "STALE")
+	case "store":
+		if body != nil {
+			body.Close()
+		}
+		if err := c.store(key, r, cw); err != nil {
+			fmt.Fprintln(errorLog, "Error writing proxy cache:", err)
+		}
+		c.evict()
+	default:
+		if body != nil {
+			body.Close()
+		}
+	}
+}
+
+func (c *proxyCache) store(key string, r *http.Request, cw *cacheResponseWriter) error {
+	if err := cw.file.Close(); err != nil || cw.failed {
+		return err
+	}
+	if length := cw.header.Get("Content-Length"); length != "" && length != strconv.FormatInt(cw.written, 10) {
+		return nil
+	}
+	if err := os.Rename(cw.file.Name(), key+".body"); err != nil {
+		return err
+	}
+
+	lifetime, _ := cacheLifetime(cw.header)
+	return c.save(key, &cacheEntry{
+		URL:      r.URL.RequestURI(),
+		Header:   cw.header,
+		Stored:   time.Now(),
+		Lifetime: lifetime,
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type redirectRule struct {
+	from   pathPattern
+	to     string
+	status int
+	force  bool
+}
+
+var placeholderPattern = regexp.MustCompile(`:[A-Za-z_][A-Za-z0-9_]*`)
+
+func (rule redirectRule) target(params map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(rule.to, func(placeholder string) string {
+		if value, ok := params[placeholder[1:]]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+func parseRedirects(name string) ([]redirectRule, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := []redirectRule{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		rule := redirectRule{
+			from:   newPathPattern(fields[0]),
+			to:     fields[1],
+			status: http.StatusMovedPermanently,
+		}
+
+		if len(fields) > 2 {
+			status := fields[2]
+			if strings.HasSuffix(status, "!") {
+				rule.force = true
+				status = strings.TrimSuffix(status, "!")
+			}
+			if code, err := strconv.Atoi(status); err == nil {
+				rule.status = code
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusResponseWriter) WriteHeader(status int) {
+	if status == http.StatusOK {
+		status = w.status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func withRedirects(fs http.FileSystem, redirects *ruleFile[redirectRule], h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		urlPath := path.Clean("/" + r.URL.Path)
+		if urlPath == "/_redirects" {
+			http.NotFound(w, r)
+			return
+		}
+
+		for _, rule := range redirects.load() {
+			params, ok := rule.from.match(urlPath)
+			if !ok {
+				continue
+			}
+
+			if !rule.force {
+				if file, err := fs.Open(urlPath); err == nil {
+					file.Close()
+					break
+				}
+			}
+
+			target := rule.target(params)
+			debugf(r, "matched _redirects rule /%s %s %d", strings.Join(rule.from, "/"), target, rule.status)
+
+			if rule.status >= 300 && rule.status < 400 {
+				if r.URL.RawQuery != "" && !strings.Contains(target, "?") {
+					target += "?" + r.URL.RawQuery
+				}
+				http.Redirect(w, r, target, rule.status)
+				return
+			}
+
+			if strings.Contains(target, "://") {
+				http.Redirect(w, r, target, http.StatusFound)
+				return
+			}
+
+			r = r.Clone(r.Context())
+			r.URL.Path = target
+
+			if rule.status != http.StatusOK {
+				w = &statusResponseWriter{w, rule.status}
+			}
+			break
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
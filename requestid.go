@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"net/http"
+)
+
+var requestID = flag.Bool("request-id", false, "Tag each request with an X-Request-Id response header, reusing a valid incoming one, and include it in log lines")
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func withRequestID(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if !validRequestID(id) {
+			id = newRequestID()
+			r = r.Clone(r.Context())
+			r.Header.Set("X-Request-Id", id)
+		}
+
+		w.Header().Set("X-Request-Id", id)
+		h.ServeHTTP(w, r)
+	}
+}
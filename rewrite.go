@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var rewrites listFlag
+
+func init() {
+	flag.Var(&rewrites, "rewrite", "Internally rewrite request paths in the form `'regexp replacement'` (repeatable)")
+}
+
+type rewriteRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+func parseRewrites(rules []string) ([]rewriteRule, error) {
+	parsed := []rewriteRule{}
+	for _, rule := range rules {
+		fields := strings.Fields(rule)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid rewrite %q", rule)
+		}
+
+		pattern, err := regexp.Compile(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite %q: %w", rule, err)
+		}
+
+		parsed = append(parsed, rewriteRule{pattern, fields[1]})
+	}
+	return parsed, nil
+}
+
+func withRewrites(rules []rewriteRule, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range rules {
+			if !rule.pattern.MatchString(r.URL.Path) {
+				continue
+			}
+
+			target := rule.pattern.ReplaceAllString(r.URL.Path, rule.replacement)
+			target, query, _ := strings.Cut(target, "?")
+			debugf(r, "rewrote %s to %s (-rewrite %s)", r.URL.Path, target, rule.pattern)
+
+			r = r.Clone(r.Context())
+			r.URL.Path = target
+			if query != "" {
+				if r.URL.RawQuery != "" {
+					query += "&" + r.URL.RawQuery
+				}
+				r.URL.RawQuery = query
+			}
+			break
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
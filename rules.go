@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+type pathPattern []string
+
+func newPathPattern(pattern string) pathPattern {
+	return strings.Split(strings.Trim(pattern, "/"), "/")
+}
+
+func (p pathPattern) match(urlPath string) (map[string]string, bool) {
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+	params := map[string]string{}
+
+	for i, pattern := range p {
+		if pattern == "*" {
+			params["splat"] = strings.Join(segments[i:], "/")
+			return params, true
+		}
+
+		if i >= len(segments) {
+			return nil, false
+		}
+
+		if strings.HasPrefix(pattern, ":") {
+			params[pattern[1:]] = segments[i]
+		} else if strings.ContainsAny(pattern, "*?[") {
+			if ok, _ := path.Match(pattern, segments[i]); !ok {
+				return nil, false
+			}
+		} else if pattern != segments[i] {
+			return nil, false
+		}
+	}
+
+	if len(segments) != len(p) {
+		return nil, false
+	}
+
+	return params, true
+}
+
+type ruleFile[T any] struct {
+	name  string
+	parse func(name string) ([]T, error)
+
+	mu      sync.Mutex
+	rules   []T
+	modTime time.Time
+}
+
+func (f *ruleFile[T]) load() []T {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stat, err := os.Stat(f.name)
+	if err != nil {
+		f.rules, f.modTime = nil, time.Time{}
+		return nil
+	}
+
+	if !stat.ModTime().Equal(f.modTime) {
+		rules, err := f.parse(f.name)
+		if err != nil {
+			return f.rules
+		}
+		f.rules, f.modTime = rules, stat.ModTime()
+	}
+
+	return f.rules
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	secure            = flag.Bool("secure", false, "Add a preset of security headers to every response")
+	referrerPolicy    = flag.String("referrer-policy", "strict-origin-when-cross-origin", "Set the Referrer-Policy `value` sent by -secure (empty to omit)")
+	frameOptions      = flag.String("frame-options", "DENY", "Set the X-Frame-Options `value` sent by -secure: DENY or SAMEORIGIN (empty to omit)")
+	permissionsPolicy = flag.String("permissions-policy", "camera=(), microphone=(), geolocation=(), interest-cohort=()", "Set the Permissions-Policy `value` sent by -secure (empty to omit)")
+)
+
+var frameAncestors = map[string]string{
+	"DENY":       "'none'",
+	"SAMEORIGIN": "'self'",
+}
+
+func securityHeaders() (http.Header, error) {
+	h := http.Header{}
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	if *referrerPolicy != "" {
+		h.Set("Referrer-Policy", *referrerPolicy)
+	}
+
+	if *frameOptions != "" {
+		option := strings.ToUpper(*frameOptions)
+		ancestors, ok := frameAncestors[option]
+		if !ok {
+			return nil, fmt.Errorf("invalid frame option %q", *frameOptions)
+		}
+		h.Set("X-Frame-Options", option)
+		h.Set("Content-Security-Policy", "frame-ancestors "+ancestors)
+	}
+
+	if *permissionsPolicy != "" {
+		h.Set("Permissions-Policy", *permissionsPolicy)
+	}
+
+	return h, nil
+}
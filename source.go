@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+var prettySource = flag.Bool("pretty-source", false, "Show source files opened in a browser as highlighted HTML with line numbers (use ?raw=1 for the original)")
+
+const maxPrettySourceSize = 1 << 20
+
+var sourceTemplate = template.Must(template.New("source").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Name}}</title>
+<style>
+  body { margin: 0; font: 15px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; color: #1f2328; background: #fff; }
+  header { display: flex; justify-content: space-between; padding: 12px 16px; border-bottom: 1px solid #d1d9e0; }
+  a { color: #0969da; text-decoration: none; }
+  pre { margin: 0; padding: 12px 0; font: 13px/1.5 ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; overflow: auto; }
+  @media (prefers-color-scheme: dark) {
+    body { color: #e6edf3; background: #0d1117; }
+    header { border-color: #30363d; }
+    a { color: #4493f8; }
+  }
+{{.LightCSS}}
+  @media (prefers-color-scheme: dark) {
+{{.DarkCSS}}
+  }
+</style>
+</head>
+<body>
+<header>
+  <strong>{{.Name}}</strong>
+  <a href="?raw=1">Raw</a>
+</header>
+{{.Code}}
+</body>
+</html>
+`))
+
+type sourceHighlighter struct {
+	formatter *chromahtml.Formatter
+	lightCSS  template.CSS
+	darkCSS   template.CSS
+}
+
+func newSourceHighlighter() *sourceHighlighter {
+	formatter := chromahtml.New(chromahtml.WithClasses(true), chromahtml.WithLineNumbers(true), chromahtml.WithLinkableLineNumbers(true, "L"))
+
+	css := func(name string) template.CSS {
+		buf := bytes.Buffer{}
+		formatter.WriteCSS(&buf, styles.Get(name))
+		return template.CSS(buf.String())
+	}
+	return &sourceHighlighter{formatter, css("github"), css("github-dark")}
+}
+
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+func (s *sourceHighlighter) render(w io.Writer, name string, lexer chroma.Lexer, source string) error {
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, source)
+	if err != nil {
+		return err
+	}
+
+	code := bytes.Buffer{}
+	if err := s.formatter.Format(&code, styles.Get("github"), iterator); err != nil {
+		return err
+	}
+
+	return sourceTemplate.Execute(w, map[string]any{
+		"Name":     name,
+		"LightCSS": s.lightCSS,
+		"DarkCSS":  s.darkCSS,
+		"Code":     template.HTML(code.String()),
+	})
+}
+
+func withPrettySource(fs http.FileSystem, h http.Handler) http.HandlerFunc {
+	highlighter := newSourceHighlighter()
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		ext := strings.ToLower(path.Ext(name))
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.URL.Query().Has("raw") ||
+			ext == ".html" || ext == ".htm" || !wantsHTML(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		lexer := lexers.Match(path.Base(name))
+		if lexer == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		file, err := fs.Open(name)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		defer file.Close()
+
+		stat, err := file.Stat()
+		if err != nil || stat.IsDir() || stat.Size() > maxPrettySourceSize {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		page := bytes.Buffer{}
+		if err := highlighter.render(&page, path.Base(name), lexer, string(data)); err != nil {
+			fmt.Fprintln(errorLog, "Error highlighting source:", err)
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		addVary(w.Header(), "Accept")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		http.ServeContent(w, r, "", stat.ModTime(), bytes.NewReader(page.Bytes()))
+	}
+}
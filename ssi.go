@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var ssi = flag.Bool("ssi", false, "Process <!--#include file=\"...\" --> and <!--#include virtual=\"...\" --> directives in HTML responses")
+
+const (
+	ssiMaxDepth = 8
+	ssiError    = "[an error occurred while processing this directive]"
+)
+
+var (
+	ssiDirective = regexp.MustCompile(`<!--#include((?:\s+\w+\s*=\s*"[^"]*")+)\s*-->`)
+	ssiAttribute = regexp.MustCompile(`(\w+)\s*=\s*"([^"]*)"`)
+)
+
+func init() {
+	mime.AddExtensionType(".shtml", "text/html; charset=utf-8")
+}
+
+func expandIncludes(fs http.FileSystem, data []byte, dir string, depth int) []byte {
+	return ssiDirective.ReplaceAllFunc(data, func(directive []byte) []byte {
+		attrs := ssiAttribute.FindSubmatch(ssiDirective.FindSubmatch(directive)[1])
+		if attrs == nil || depth >= ssiMaxDepth {
+			return []byte(ssiError)
+		}
+
+		name, value := string(attrs[1]), string(attrs[2])
+		target := ""
+		switch {
+		case name == "file" && !strings.HasPrefix(value, "/") && !strings.Contains(value, ".."):
+			target = path.Join(dir, value)
+		case name == "virtual" && strings.HasPrefix(value, "/"):
+			target = path.Clean(value)
+		case name == "virtual":
+			target = path.Join(dir, value)
+		default:
+			return []byte(ssiError)
+		}
+
+		file, err := fs.Open(target)
+		if err != nil {
+			return []byte(ssiError)
+		}
+		defer file.Close()
+
+		stat, err := file.Stat()
+		if err != nil || stat.IsDir() {
+			return []byte(ssiError)
+		}
+
+		included, err := io.ReadAll(file)
+		if err != nil {
+			return []byte(ssiError)
+		}
+		return expandIncludes(fs, included, path.Dir(target), depth+1)
+	})
+}
+
+func withSSI(fs http.FileSystem, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dir := path.Clean("/" + r.URL.Path)
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			dir = path.Dir(dir)
+		}
+
+		hw := &htmlResponseWriter{ResponseWriter: w, r: r, dynamic: true, transform: func(data []byte) []byte {
+			return expandIncludes(fs, data, dir, 0)
+		}}
+
+		h.ServeHTTP(hw, uncachedHTMLRequest(r))
+		hw.finish()
+	}
+}
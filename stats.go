@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	maxStatsPaths   = 10000
+	maxStatsSamples = 10000
+	maxStatsRecent  = 50
+)
+
+type recentRequest struct {
+	Time     time.Time `json:"time"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Status   int       `json:"status"`
+	Bytes    int64     `json:"bytes"`
+	Duration float64   `json:"duration_ms"`
+	IP       string    `json:"ip"`
+}
+
+type trafficStats struct {
+	mu        sync.Mutex
+	started   time.Time
+	requests  int64
+	bytes     int64
+	statuses  map[int]int64
+	paths     map[string]int64
+	countries map[string]int64
+	latencies []time.Duration
+	recent    []recentRequest
+}
+
+var traffic = newTrafficStats()
+
+func newTrafficStats() *trafficStats {
+	return &trafficStats{
+		started:   time.Now(),
+		statuses:  map[int]int64{},
+		paths:     map[string]int64{},
+		countries: map[string]int64{},
+	}
+}
+
+func (s *trafficStats) record(r *http.Request, status int, bytes int64, latency time.Duration) {
+	country := lookupLocation(r).country
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+	s.bytes += bytes
+	s.statuses[status]++
+	if _, ok := s.paths[r.URL.Path]; ok || len(s.paths) < maxStatsPaths {
+		s.paths[r.URL.Path]++
+	}
+	if country != "" {
+		s.countries[country]++
+	}
+
+	if len(s.latencies) < maxStatsSamples {
+		s.latencies = append(s.latencies, latency)
+	} else if i := rand.Int63n(s.requests); i < maxStatsSamples {
+		s.latencies[i] = latency
+	}
+
+	s.recent = append(s.recent, recentRequest{
+		time.Now(), r.Method, r.URL.Path, status, bytes, milliseconds(latency), remoteIP(r),
+	})
+	if len(s.recent) > maxStatsRecent {
+		s.recent = s.recent[len(s.recent)-maxStatsRecent:]
+	}
+}
+
+type pathCount struct {
+	Path     string `json:"path"`
+	Requests int64  `json:"requests"`
+}
+
+type countryCount struct {
+	Country  string `json:"country"`
+	Requests int64  `json:"requests"`
+}
+
+type trafficSnapshot struct {
+	Started      time.Time          `json:"started"`
+	Requests     int64              `json:"requests"`
+	Bytes        int64              `json:"bytes"`
+	Statuses     map[int]int64      `json:"statuses"`
+	TopPaths     []pathCount        `json:"top_paths"`
+	TopCountries []countryCount     `json:"top_countries,omitempty"`
+	Latency      map[string]float64 `json:"latency_ms"`
+	Recent       []recentRequest    `json:"recent"`
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[min(int(float64(len(sorted))*p), len(sorted)-1)]
+}
+
+func (s *trafficStats) snapshot(topPaths int) trafficSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snap := trafficSnapshot{
+		Started:  s.started,
+		Requests: s.requests,
+		Bytes:    s.bytes,
+		Statuses: map[int]int64{},
+		TopPaths: []pathCount{},
+		Recent:   append([]recentRequest{}, s.recent...),
+	}
+	for status, n := range s.statuses {
+		snap.Statuses[status] = n
+	}
+
+	latencies := append([]time.Duration{}, s.latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	snap.Latency = map[string]float64{
+		"p50": milliseconds(percentile(latencies, 0.5)),
+		"p90": milliseconds(percentile(latencies, 0.9)),
+		"p99": milliseconds(percentile(latencies, 0.99)),
+		"max": milliseconds(percentile(latencies, 1)),
+	}
+
+	for p, n := range s.paths {
+		snap.TopPaths = append(snap.TopPaths, pathCount{p, n})
+	}
+	sort.Slice(snap.TopPaths, func(i, j int) bool {
+		a, b := snap.TopPaths[i], snap.TopPaths[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Path < b.Path
+	})
+	snap.TopPaths = snap.TopPaths[:min(len(snap.TopPaths), topPaths)]
+
+	for c, n := range s.countries {
+		snap.TopCountries = append(snap.TopCountries, countryCount{c, n})
+	}
+	sort.Slice(snap.TopCountries, func(i, j int) bool {
+		a, b := snap.TopCountries[i], snap.TopCountries[j]
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Country < b.Country
+	})
+	snap.TopCountries = snap.TopCountries[:min(len(snap.TopCountries), topPaths)]
+
+	return snap
+}
+
+func (s *trafficStats) writeSummary(w io.Writer) {
+	snap := s.snapshot(5)
+	if snap.Requests == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Requests\t%d in %s\n", snap.Requests, time.Since(snap.Started).Round(time.Second))
+	fmt.Fprintf(tw, "Served\t%s\n", humanSize(snap.Bytes))
+
+	statuses := make([]int, 0, len(snap.Statuses))
+	for status := range snap.Statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	breakdown := []string{}
+	for _, status := range statuses {
+		breakdown = append(breakdown, fmt.Sprintf("%d × %d", status, snap.Statuses[status]))
+	}
+	fmt.Fprintf(tw, "Statuses\t%s\n", strings.Join(breakdown, ", "))
+
+	fmt.Fprintf(
+		tw, "Latency\tp50 %.2fms, p90 %.2fms, p99 %.2fms, max %.2fms\n",
+		snap.Latency["p50"], snap.Latency["p90"], snap.Latency["p99"], snap.Latency["max"],
+	)
+
+	for i, p := range snap.TopPaths {
+		label := ""
+		if i == 0 {
+			label = "Top paths"
+		}
+		fmt.Fprintf(tw, "%s\t%d  %s\n", label, p.Requests, p.Path)
+	}
+
+	for i, c := range snap.TopCountries {
+		label := ""
+		if i == 0 {
+			label = "Top countries"
+		}
+		fmt.Fprintf(tw, "%s\t%d  %s\n", label, c.Requests, c.Country)
+	}
+
+	tw.Flush()
+	fmt.Fprintln(w)
+}
+
+func withStats(stats *trafficStats, h http.Handler) http.HandlerFunc {
+	dashboard := *webDashboard
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		lrw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(lrw, r)
+
+		if dashboard && strings.HasPrefix(r.URL.Path, "/_dashboard") {
+			return
+		}
+		stats.record(r, lrw.status, lrw.bytes, time.Since(start))
+	}
+}
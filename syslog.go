@@ -0,0 +1,24 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"io"
+	"log/syslog"
+)
+
+type syslogErrorWriter struct {
+	w *syslog.Writer
+}
+
+func (e syslogErrorWriter) Write(p []byte) (int, error) {
+	return len(p), e.w.Err(string(p))
+}
+
+func openSyslog(network, addr string) (io.Writer, io.Writer, error) {
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, "serve")
+	if err != nil {
+		return nil, nil, err
+	}
+	return w, syslogErrorWriter{w}, nil
+}
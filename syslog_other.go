@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+func openSyslog(network, addr string) (io.Writer, io.Writer, error) {
+	return nil, nil, errors.New("-syslog is not supported on this platform")
+}
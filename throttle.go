@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	throttle     = flag.String("throttle", "", "Limit total outbound bandwidth to a `rate` such as 500KB/s or 5MB/s")
+	connThrottle = flag.String("conn-throttle", "", "Limit outbound bandwidth per connection to a `rate` such as 500KB/s")
+	network      = flag.String("network", "", "Simulate a slow network `profile` with added latency and per-connection bandwidth: 3g, dsl or slow")
+)
+
+type networkProfile struct {
+	rate    float64
+	latency time.Duration
+}
+
+var networkProfiles = map[string]networkProfile{
+	"dsl":  {187500, 50 * time.Millisecond},
+	"3g":   {200000, 300 * time.Millisecond},
+	"slow": {50000, 400 * time.Millisecond},
+}
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+}
+
+func parseSize(value string) (float64, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	i := strings.IndexFunc(s, func(c rune) bool { return (c < '0' || c > '9') && c != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	unit, ok := sizeUnits[strings.TrimSpace(s[i:])]
+	if err != nil || !ok || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * unit, nil
+}
+
+func parseRate(value string) (float64, error) {
+	n, err := parseSize(strings.TrimSuffix(strings.TrimSpace(value), "/s"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q", value)
+	}
+	return n, nil
+}
+
+func newRateLimiter(bytesPerSecond float64) *rate.Limiter {
+	burst := 64 << 10
+	if bytesPerSecond < float64(burst) {
+		burst = max(int(bytesPerSecond), 1)
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+type throttledConn struct {
+	net.Conn
+	limiters []*rate.Limiter
+}
+
+func (c *throttledConn) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		chunk := len(b)
+		for _, l := range c.limiters {
+			chunk = min(chunk, l.Burst())
+		}
+
+		for _, l := range c.limiters {
+			if err := l.WaitN(context.Background(), chunk); err != nil {
+				return written, err
+			}
+		}
+
+		n, err := c.Conn.Write(b[:chunk])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[chunk:]
+	}
+	return written, nil
+}
+
+type throttledListener struct {
+	net.Listener
+	limiter *rate.Limiter
+	perConn float64
+}
+
+func (l throttledListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	limiters := []*rate.Limiter{}
+	if l.limiter != nil {
+		limiters = append(limiters, l.limiter)
+	}
+	if l.perConn != 0 {
+		limiters = append(limiters, newRateLimiter(l.perConn))
+	}
+	return &throttledConn{conn, limiters}, nil
+}
+
+func withLatency(latency time.Duration, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var (
+	certFiles listFlag
+	keyFiles  listFlag
+
+	certDir = flag.String("cert-dir", "", "Serve over HTTPS using every <name>.crt and <name>.key pair in `dir`")
+	selfTLS = flag.Bool("tls", false, "Serve over HTTPS using a generated self-signed certificate")
+	caDir   = flag.String("tls-ca", "", "Store the CA used by -tls in `dir` so it can be trusted across runs")
+	domains = flag.String("domain", "", "Obtain certificates from Let's Encrypt for a comma-separated list of `domains`")
+	acmeDir = flag.String("acme-cache", "", "Cache Let's Encrypt certificates in `dir` (default: user cache directory)")
+	tlsMin  = flag.String("tls-min", "1.2", "Set the minimum TLS `version` to accept (1.2 or 1.3)")
+	ciphers = flag.String("tls-ciphers", "", "Restrict TLS 1.2 connections to a comma-separated list of cipher `suites`")
+
+	redirectAddr = flag.String("redirect-http", "", "Redirect plain HTTP requests on `host:port` or `port` to HTTPS")
+)
+
+func init() {
+	flag.Var(&certFiles, "cert", "Serve over HTTPS using the certificate at `file` (requires -key, repeatable)")
+	flag.Var(&keyFiles, "key", "Serve over HTTPS using the private key at `file` (requires -cert, repeatable)")
+}
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func newTLSConfig(host string) (*tls.Config, error) {
+	config, err := baseTLSConfig(host)
+	if err != nil || config == nil {
+		return config, err
+	}
+
+	version, ok := tlsVersions[*tlsMin]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS version %q", *tlsMin)
+	}
+	config.MinVersion = version
+
+	if *ciphers != "" {
+		suites := map[string]uint16{}
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+
+		for _, name := range strings.Split(*ciphers, ",") {
+			id, ok := suites[strings.TrimSpace(name)]
+			if !ok {
+				return nil, fmt.Errorf("unsupported cipher suite %q", name)
+			}
+			config.CipherSuites = append(config.CipherSuites, id)
+		}
+	}
+
+	return config, nil
+}
+
+func baseTLSConfig(host string) (*tls.Config, error) {
+	if len(certFiles) != len(keyFiles) {
+		return nil, errors.New("-cert and -key must be provided together")
+	}
+
+	certPaths := append([]string{}, certFiles...)
+	keyPaths := append([]string{}, keyFiles...)
+	if *certDir != "" {
+		matches, err := filepath.Glob(filepath.Join(*certDir, "*.crt"))
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, errors.New("no certificates found in " + *certDir)
+		}
+		for _, match := range matches {
+			certPaths = append(certPaths, match)
+			keyPaths = append(keyPaths, strings.TrimSuffix(match, ".crt")+".key")
+		}
+	}
+
+	if len(certPaths) != 0 {
+		certs := certSet{}
+		for i := range certPaths {
+			reloader, err := newCertReloader(certPaths[i], keyPaths[i])
+			if err != nil {
+				return nil, err
+			}
+			go reloader.watch(2 * time.Second)
+			certs = append(certs, reloader)
+		}
+		return &tls.Config{GetCertificate: certs.GetCertificate}, nil
+	}
+
+	if *domains != "" {
+		return acmeTLSConfig()
+	}
+
+	if *selfTLS || *caDir != "" {
+		cert, err := generateCert(host)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+	}
+
+	return nil, nil
+}
+
+type certReloader struct {
+	certPath string
+	keyPath  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	r := &certReloader{certPath: certPath, keyPath: keyPath}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	latest := time.Time{}
+	for _, path := range []string{r.certPath, r.keyPath} {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if stat.ModTime().After(latest) {
+			latest = stat.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *certReloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return err
+	}
+
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		modTime, err := r.latestModTime()
+		if err != nil {
+			continue
+		}
+
+		r.mu.RLock()
+		changed := !modTime.Equal(r.modTime)
+		r.mu.RUnlock()
+
+		if changed {
+			if err := r.reload(); err != nil {
+				fmt.Fprintln(errorLog, "Error reloading certificate:", err)
+			}
+		}
+	}
+}
+
+func (r *certReloader) certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+type certSet []*certReloader
+
+func (s certSet) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if len(s) > 1 {
+		for _, r := range s {
+			cert := r.certificate()
+			if hello.SupportsCertificate(cert) == nil {
+				return cert, nil
+			}
+		}
+	}
+	return s[0].certificate(), nil
+}
+
+func acmeTLSConfig() (*tls.Config, error) {
+	names := []string{}
+	for _, d := range strings.Split(*domains, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			names = append(names, d)
+		}
+	}
+
+	cacheDir := *acmeDir
+	if cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		cacheDir = filepath.Join(dir, "serve", "autocert")
+	}
+
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(names...),
+		Cache:      autocert.DirCache(cacheDir),
+	}
+
+	return m.TLSConfig(), nil
+}
+
+func loadOrCreateCA() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPath := filepath.Join(*caDir, "ca.pem")
+	keyPath := filepath.Join(*caDir, "ca-key.pem")
+
+	if *caDir != "" {
+		if pair, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+			cert, err := x509.ParseCertificate(pair.Certificate[0])
+			if err != nil {
+				return nil, nil, err
+			}
+			key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+			if !ok {
+				return nil, nil, errors.New("unsupported CA key type in " + keyPath)
+			}
+			return cert, key, nil
+		} else if !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{Organization: []string{"serve"}, CommonName: "serve local CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if *caDir != "" {
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := os.MkdirAll(*caDir, 0o700); err != nil {
+			return nil, nil, err
+		}
+		if err := writePEM(certPath, "CERTIFICATE", der, 0o644); err != nil {
+			return nil, nil, err
+		}
+		if err := writePEM(keyPath, "EC PRIVATE KEY", keyDER, 0o600); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return cert, key, nil
+}
+
+func generateCert(host string) (tls.Certificate, error) {
+	ca, caKey, err := loadOrCreateCA()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{Organization: []string{"serve"}, CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(0, 0, 30),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	if ip := getLocalIP(); ip != "" {
+		template.IPAddresses = append(template.IPAddresses, net.ParseIP(ip))
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if !ip.IsUnspecified() && !ip.IsLoopback() {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	} else if host != "localhost" {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der, ca.Raw}, PrivateKey: key}, nil
+}
+
+func redirectToHTTPS(port string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
+
+func randomSerial() *big.Int {
+	serial, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	return serial
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	return os.WriteFile(path, data, perm)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"path"
+	"path/filepath"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var otelTracing = flag.Bool("otel", false, "Export a trace span for every request over OTLP, configured with the standard OTEL_* environment variables")
+
+var tracer = otel.Tracer("github.com/lukecjohnson/serve")
+
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(
+		ctx,
+		resource.WithAttributes(semconv.ServiceName("serve")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+func withTracing(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(
+			ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.URLScheme(scheme),
+				semconv.ServerAddress(r.Host),
+				semconv.ClientAddress(remoteIP(r)),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		lrw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(lrw, r.WithContext(ctx))
+
+		span.SetAttributes(
+			semconv.HTTPResponseStatusCode(lrw.status),
+			semconv.HTTPResponseBodySize(int(lrw.bytes)),
+		)
+		if lrw.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(lrw.status))
+		}
+	}
+}
+
+func withFileSpans(root string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Join(root, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+		ctx, span := tracer.Start(r.Context(), "serve file", trace.WithAttributes(semconv.FilePath(name)))
+		defer span.End()
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
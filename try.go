@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var tryFiles = flag.String("try", "", "Resolve requests by trying a space-separated list of `paths` such as '$uri $uri.html $uri/ /404.html' in order, ending with a fallback path or =status")
+
+func parseTryFiles(value string) ([]string, error) {
+	candidates := strings.Fields(value)
+	if len(candidates) < 2 {
+		return nil, fmt.Errorf("invalid -try %q: expected at least one path and a fallback", value)
+	}
+
+	for i, candidate := range candidates {
+		if code, ok := strings.CutPrefix(candidate, "="); ok && i == len(candidates)-1 {
+			if status, err := strconv.Atoi(code); err != nil || status < 400 || status > 599 {
+				return nil, fmt.Errorf("invalid -try status %q", candidate)
+			}
+			continue
+		}
+		if !strings.HasPrefix(candidate, "/") && !strings.HasPrefix(candidate, "$uri") {
+			return nil, fmt.Errorf("invalid -try path %q", candidate)
+		}
+	}
+	return candidates, nil
+}
+
+func tryFileExists(fs http.FileSystem, name string, dir bool) bool {
+	file, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	return err == nil && stat.IsDir() == dir
+}
+
+func withTryFiles(fs http.FileSystem, candidates []string, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uri := path.Clean("/" + r.URL.Path)
+
+		for i, candidate := range candidates {
+			last := i == len(candidates)-1
+			if code, ok := strings.CutPrefix(candidate, "="); ok && last {
+				status, _ := strconv.Atoi(code)
+				http.Error(w, fmt.Sprintf("%d %s", status, strings.ToLower(http.StatusText(status))), status)
+				return
+			}
+
+			name := strings.ReplaceAll(candidate, "$uri", uri)
+			dir := strings.HasSuffix(name, "/")
+			name = path.Clean(name)
+			if !last && !tryFileExists(fs, name, dir) {
+				continue
+			}
+
+			r = r.Clone(r.Context())
+			r.URL.Path = name
+			if dir && name != "/" {
+				r.URL.Path += "/"
+			}
+			if strings.HasSuffix(r.URL.Path, "/index.html") {
+				r.URL.Path = strings.TrimSuffix(r.URL.Path, "index.html")
+			}
+			break
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
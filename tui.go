@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+var tui = flag.Bool("tui", false, "Show a live dashboard of requests, connections and errors instead of log lines (p to pause, q to quit)")
+
+const (
+	dashboardErrors = 5
+	dashboardWindow = 5
+)
+
+type dashboardRequest struct {
+	time     time.Time
+	method   string
+	path     string
+	status   int
+	duration time.Duration
+}
+
+type dashboard struct {
+	url  string
+	quit func()
+
+	active atomic.Int64
+
+	mu       sync.Mutex
+	paused   bool
+	total    int64
+	seconds  [dashboardWindow + 1]int64
+	second   int64
+	recent   []dashboardRequest
+	errors   []string
+	state    *term.State
+	finished bool
+}
+
+func newDashboard(quit func()) (*dashboard, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil, errors.New("-tui requires a terminal")
+	}
+	return &dashboard{quit: quit}, nil
+}
+
+func (d *dashboard) start(url string) error {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.url, d.state = url, state
+	d.mu.Unlock()
+
+	fmt.Print("\033[?1049h\033[?25l")
+	go d.readKeys()
+	go d.refresh()
+	return nil
+}
+
+func (d *dashboard) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.finished || d.state == nil {
+		return
+	}
+	d.finished = true
+	fmt.Print("\033[?25h\033[?1049l")
+	term.Restore(int(os.Stdin.Fd()), d.state)
+}
+
+func (d *dashboard) readKeys() {
+	buf := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(buf); err != nil {
+			return
+		}
+
+		switch buf[0] {
+		case 'p', 'P', ' ':
+			d.mu.Lock()
+			d.paused = !d.paused
+			d.mu.Unlock()
+			d.render()
+		case 'q', 'Q', 3:
+			d.close()
+			d.quit()
+			return
+		}
+	}
+}
+
+func (d *dashboard) refresh() {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !d.render() {
+			return
+		}
+	}
+}
+
+func (d *dashboard) connState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		d.active.Add(1)
+	case http.StateClosed, http.StateHijacked:
+		d.active.Add(-1)
+	}
+}
+
+func (d *dashboard) advance(now int64) {
+	if now-d.second > int64(len(d.seconds)) {
+		d.seconds = [dashboardWindow + 1]int64{}
+		d.second = now
+		return
+	}
+	for d.second < now {
+		d.second++
+		d.seconds[d.second%int64(len(d.seconds))] = 0
+	}
+}
+
+func (d *dashboard) record(req dashboardRequest) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.total++
+	d.advance(req.time.Unix())
+	d.seconds[d.second%int64(len(d.seconds))]++
+
+	if d.paused {
+		return
+	}
+	d.recent = append(d.recent, req)
+	if len(d.recent) > 200 {
+		d.recent = d.recent[len(d.recent)-200:]
+	}
+	if req.status >= 400 {
+		d.addError(fmt.Sprintf("[%s] %d %s %s", req.time.Format(time.TimeOnly), req.status, req.method, req.path))
+	}
+}
+
+func (d *dashboard) addError(line string) {
+	d.errors = append(d.errors, line)
+	if len(d.errors) > dashboardErrors {
+		d.errors = d.errors[len(d.errors)-dashboardErrors:]
+	}
+}
+
+func (d *dashboard) Write(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	line := strings.TrimSpace(string(p))
+	d.addError(fmt.Sprintf("[%s] %s", time.Now().Format(time.TimeOnly), line))
+	return len(p), nil
+}
+
+func (d *dashboard) render() bool {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.finished {
+		return false
+	}
+
+	d.advance(time.Now().Unix())
+	count := int64(0)
+	for i, n := range d.seconds {
+		if int64(i) != d.second%int64(len(d.seconds)) {
+			count += n
+		}
+	}
+
+	lines := []string{}
+	add := func(text, color string) {
+		if len([]rune(text)) > width {
+			text = string([]rune(text)[:width])
+		}
+		if color != "" {
+			text = paint(useColor, color, text)
+		}
+		lines = append(lines, text)
+	}
+
+	title := "serve  " + d.url
+	if d.paused {
+		title += "  (paused)"
+	}
+	add(title, "1")
+	add("", "")
+	add(fmt.Sprintf(
+		"Requests/s %-8.1f Active connections %-6d Total requests %d",
+		float64(count)/dashboardWindow, d.active.Load(), d.total,
+	), "")
+	add("", "")
+
+	errorLines := len(d.errors)
+	if errorLines > 0 {
+		errorLines += 2
+	}
+	space := max(height-len(lines)-errorLines-3, 0)
+
+	add("Recent requests", "4")
+	for _, req := range d.recent[max(len(d.recent)-space, 0):] {
+		color := "32"
+		if req.status >= 400 {
+			color = "31"
+		} else if req.status >= 300 {
+			color = "33"
+		}
+		text := fmt.Sprintf(
+			"[%s] %d %s %s (%.2fms)",
+			req.time.Format(time.TimeOnly), req.status, req.method, req.path, milliseconds(req.duration),
+		)
+		add(text, color)
+	}
+
+	if len(d.errors) > 0 {
+		add("", "")
+		add("Errors", "4")
+		for _, line := range d.errors {
+			add(line, "31")
+		}
+	}
+
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = lines[:max(height-1, 0)]
+	lines = append(lines, paint(useColor, "90", "p pause  q quit"))
+
+	fmt.Print("\033[H\033[2J" + strings.Join(lines, "\r\n"))
+	return true
+}
+
+func withDashboard(d *dashboard, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		lrw := &loggingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(lrw, r)
+
+		d.record(dashboardRequest{start, r.Method, r.URL.Path, lrw.status, time.Since(start)})
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	tusVersion = "1.0.0"
+	tusExpiry  = 24 * time.Hour
+)
+
+type tusUpload struct {
+	mu      sync.Mutex
+	name    string
+	file    string
+	offset  atomic.Int64
+	length  int64
+	expires atomic.Int64
+}
+
+func (u *tusUpload) touch() {
+	u.expires.Store(time.Now().Add(tusExpiry).UnixNano())
+}
+
+func (u *tusUpload) expiry() string {
+	return time.Unix(0, u.expires.Load()).UTC().Format(http.TimeFormat)
+}
+
+type tusUploads struct {
+	mu      sync.Mutex
+	uploads map[string]*tusUpload
+	sweep   sync.Once
+}
+
+var pendingUploads = &tusUploads{uploads: map[string]*tusUpload{}}
+
+func (u *tusUploads) get(id string) *tusUpload {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.uploads[id]
+}
+
+func (u *tusUploads) add(id string, upload *tusUpload) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.uploads[id] = upload
+}
+
+func (u *tusUploads) remove(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.uploads, id)
+}
+
+func (u *tusUploads) expire(now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for id, upload := range u.uploads {
+		if now.UnixNano() < upload.expires.Load() || !upload.mu.TryLock() {
+			continue
+		}
+		delete(u.uploads, id)
+		os.Remove(upload.file)
+		upload.mu.Unlock()
+	}
+}
+
+func (u *tusUploads) expireEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		u.expire(now)
+	}
+}
+
+type tusServer struct {
+	settings *settings
+	maxSize  int64
+	uploads  *tusUploads
+}
+
+func parseTusMetadata(header string) map[string]string {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata
+}
+
+func (s *tusServer) create(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "400 invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if s.maxSize > 0 && length > s.maxSize {
+		http.Error(w, "413 request entity too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	filename := parseTusMetadata(r.Header.Get("Upload-Metadata"))["filename"]
+	urlPath := path.Clean("/" + filename)
+	if filename == "" || urlPath == "/" {
+		http.Error(w, "400 missing filename metadata", http.StatusBadRequest)
+		return
+	}
+	if s.settings.isHiddenPath(urlPath) || s.settings.isReservedUpload(urlPath) {
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+
+	name := filepath.Join(s.settings.root, filepath.FromSlash(urlPath))
+	if _, err := os.Stat(name); err == nil && !s.settings.overwrite {
+		http.Error(w, "409 file already exists", http.StatusConflict)
+		return
+	}
+
+	tmp, err := createUploadTemp(name)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	tmp.Close()
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	upload := &tusUpload{name: name, file: tmp.Name(), length: length}
+	upload.touch()
+
+	s.uploads.add(id, upload)
+
+	if length == 0 {
+		if err := s.finish(id, upload); err != nil {
+			uploadError(w, err)
+			return
+		}
+	}
+
+	w.Header().Set("Location", "/_tus/"+id)
+	if length != 0 {
+		w.Header().Set("Upload-Expires", upload.expiry())
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *tusServer) finish(id string, upload *tusUpload) error {
+	s.uploads.remove(id)
+
+	err := commitUpload(upload.file, upload.name, s.settings.overwrite)
+	if err != nil {
+		os.Remove(upload.file)
+	}
+	return err
+}
+
+func (s *tusServer) patch(w http.ResponseWriter, r *http.Request, id string, upload *tusUpload) {
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "415 unsupported media type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if !upload.mu.TryLock() {
+		http.Error(w, "409 upload in progress", http.StatusConflict)
+		return
+	}
+	defer upload.mu.Unlock()
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != upload.offset.Load() {
+		http.Error(w, "409 offset mismatch", http.StatusConflict)
+		return
+	}
+
+	file, err := os.OpenFile(upload.file, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	n, copyErr := io.Copy(file, io.LimitReader(r.Body, upload.length-offset))
+	if err := file.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	offset = upload.offset.Add(n)
+	upload.touch()
+
+	if copyErr != nil {
+		uploadError(w, copyErr)
+		return
+	}
+
+	if offset == upload.length {
+		if err := s.finish(id, upload); err != nil {
+			uploadError(w, err)
+			return
+		}
+	} else {
+		w.Header().Set("Upload-Expires", upload.expiry())
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *tusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", tusVersion)
+		w.Header().Set("Tus-Extension", "creation,termination,expiration")
+		if s.maxSize > 0 {
+			w.Header().Set("Tus-Max-Size", strconv.FormatInt(s.maxSize, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		http.Error(w, "412 unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/_tus/")
+	if id == "" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.create(w, r)
+		return
+	}
+
+	upload := s.uploads.get(id)
+	if upload == nil {
+		http.Error(w, "404 not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Upload-Offset", strconv.FormatInt(upload.offset.Load(), 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(upload.length, 10))
+		w.Header().Set("Upload-Expires", upload.expiry())
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		s.patch(w, r, id, upload)
+	case http.MethodDelete:
+		upload.mu.Lock()
+		defer upload.mu.Unlock()
+		s.uploads.remove(id)
+		os.Remove(upload.file)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func withTus(cfg *settings, maxSize int64, h http.Handler) http.HandlerFunc {
+	tus := &tusServer{settings: cfg, maxSize: maxSize, uploads: pendingUploads}
+	pendingUploads.sweep.Do(func() {
+		go pendingUploads.expireEvery(time.Hour)
+	})
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_tus" && !strings.HasPrefix(r.URL.Path, "/_tus/") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == "/_tus" {
+			r = r.Clone(r.Context())
+			r.URL.Path = "/_tus/"
+		}
+		tus.ServeHTTP(w, r)
+	}
+}
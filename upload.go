@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	upload    = flag.Bool("upload", false, "Accept file uploads with PUT, multipart POST to directories and tus resumable uploads at /_tus/ (limit size with -max-body)")
+	overwrite = flag.Bool("overwrite", false, "Allow uploads to replace existing files")
+)
+
+var errFileExists = errors.New("file already exists")
+
+var reservedUploads = map[string]bool{
+	"/_redirects": true,
+	"/_headers":   true,
+}
+
+func (s *settings) isReservedUpload(urlPath string) bool {
+	urlPath = path.Clean("/" + urlPath)
+	return reservedUploads[urlPath] || urlPath == s.configPath || strings.HasPrefix(path.Base(urlPath), ".serve")
+}
+
+func createUploadTemp(name string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(filepath.Dir(name), ".upload-*")
+}
+
+func commitUpload(tmpName, name string, overwrite bool) error {
+	if err := os.Chmod(tmpName, 0o644); err != nil {
+		return err
+	}
+
+	if overwrite {
+		return os.Rename(tmpName, name)
+	}
+	if err := os.Link(tmpName, name); err != nil {
+		if os.IsExist(err) {
+			return errFileExists
+		}
+		return err
+	}
+	return os.Remove(tmpName)
+}
+
+func saveUpload(cfg *settings, urlPath string, r io.Reader) error {
+	name := filepath.Join(cfg.root, filepath.FromSlash(urlPath))
+	tmp, err := createUploadTemp(name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return commitUpload(tmp.Name(), name, cfg.overwrite)
+}
+
+func uploadError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, errFileExists):
+		http.Error(w, "409 file already exists", http.StatusConflict)
+	case errors.As(err, &maxBytesErr):
+		w.Header().Set("Connection", "close")
+		http.Error(w, "413 request entity too large", http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, "500 error saving upload", http.StatusInternalServerError)
+	}
+}
+
+func withUploads(cfg *settings, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodPost {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		urlPath := path.Clean("/" + r.URL.Path)
+		if cfg.isHiddenPath(urlPath) || (r.Method == http.MethodPut && cfg.isReservedUpload(urlPath)) {
+			http.Error(w, "403 forbidden", http.StatusForbidden)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			if strings.HasSuffix(r.URL.Path, "/") {
+				http.Error(w, "400 cannot upload to a directory", http.StatusBadRequest)
+				return
+			}
+			if err := saveUpload(cfg, urlPath, r.Body); err != nil {
+				uploadError(w, err)
+				return
+			}
+			w.Header().Set("Location", r.URL.Path)
+			http.Error(w, "201 created", http.StatusCreated)
+			return
+		}
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, "400 expected a multipart form", http.StatusBadRequest)
+			return
+		}
+
+		dir := strings.TrimSuffix(urlPath, "/") + "/"
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				uploadError(w, err)
+				return
+			}
+
+			name := path.Base(strings.ReplaceAll(part.FileName(), "\\", "/"))
+			if part.FileName() == "" || name == "." || name == ".." || cfg.isHiddenPath(name) || cfg.isReservedUpload(dir+name) {
+				part.Close()
+				continue
+			}
+			err = saveUpload(cfg, dir+name, part)
+			part.Close()
+			if err != nil {
+				uploadError(w, err)
+				return
+			}
+		}
+
+		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+var uaAllow, uaDeny listFlag
+
+func init() {
+	flag.Var(&uaAllow, "ua-allow", "Only allow requests whose User-Agent matches the `regexp` (repeatable)")
+	flag.Var(&uaDeny, "ua-deny", "Deny requests whose User-Agent matches the `regexp` (repeatable)")
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid User-Agent pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func withUserAgentFilter(cfg *settings, allow, deny []*regexp.Regexp, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ua := r.UserAgent()
+		if matchesAny(deny, ua) || (len(allow) != 0 && !matchesAny(allow, ua)) {
+			if !cfg.quiet {
+				fmt.Fprintf(errorLog, "Blocked user agent %q from %s\n", ua, r.RemoteAddr)
+			}
+			http.Error(w, "403 forbidden", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/net/websocket"
+)
+
+var (
+	watch         = flag.Bool("watch", false, "Reload browsers viewing HTML pages when files under the root change, and stream changes as server-sent events at /_events")
+	onChange      = flag.String("on-change", "", "Run `command` when watched files change, then reload browsers (implies -watch)")
+	watchDebounce = flag.Duration("watch-debounce", 100*time.Millisecond, "Wait for changes to settle for `duration` before reloading or running -on-change")
+
+	watchIgnore listFlag
+)
+
+func init() {
+	flag.Var(&watchIgnore, "watch-ignore", "Ignore changes to paths matching the gitignore-style `pattern`, in addition to .git and node_modules (repeatable)")
+}
+
+const (
+	liveReloadPath = "/_livereload"
+	eventsPath     = "/_events"
+)
+
+const liveReloadScript = `<script>
+(() => {
+  const connect = () => {
+    const ws = new WebSocket(location.origin.replace(/^http/, "ws") + "` + liveReloadPath + `");
+    ws.onmessage = () => location.reload();
+    ws.onclose = () => setTimeout(connect, 1000);
+  };
+  connect();
+})();
+</script>
+`
+
+type fileEvent struct {
+	Path string    `json:"path"`
+	Op   string    `json:"op"`
+	Time time.Time `json:"timestamp"`
+}
+
+type watchHub struct {
+	root     string
+	settings *settings
+	command  string
+	ignore   ignoreRules
+	debounce time.Duration
+	watcher  *fsnotify.Watcher
+	changed  chan struct{}
+
+	mu          sync.Mutex
+	subscribers map[chan fileEvent]bool
+	reloaders   map[chan struct{}]bool
+}
+
+func newWatchHub(cfg *settings, command string, ignore ignoreRules, debounce time.Duration) (*watchHub, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	hub := &watchHub{
+		root:        cfg.root,
+		settings:    cfg,
+		command:     command,
+		ignore:      ignore,
+		debounce:    debounce,
+		watcher:     watcher,
+		changed:     make(chan struct{}, 1),
+		subscribers: map[chan fileEvent]bool{},
+		reloaders:   map[chan struct{}]bool{},
+	}
+	if err := hub.add(hub.root); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go hub.run()
+	go hub.rebuild()
+	return hub, nil
+}
+
+func startWatching(cfg *settings) (*watchHub, error) {
+	if !*watch && *onChange == "" {
+		return nil, nil
+	}
+	ignore := parseIgnorePatterns(append(listFlag{"node_modules", ".git"}, watchIgnore...))
+	return newWatchHub(cfg, *onChange, ignore, *watchDebounce)
+}
+
+func (hub *watchHub) close() {
+	if hub != nil {
+		hub.watcher.Close()
+	}
+}
+
+func (hub *watchHub) add(dir string) error {
+	return filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if name != hub.root && hub.skip(name, true) {
+			return filepath.SkipDir
+		}
+		return hub.watcher.Add(name)
+	})
+}
+
+func (hub *watchHub) urlPath(name string) string {
+	rel, err := filepath.Rel(hub.root, name)
+	if err != nil {
+		return "/"
+	}
+	return path.Clean("/" + filepath.ToSlash(rel))
+}
+
+func (hub *watchHub) skip(name string, isDir bool) bool {
+	urlPath := hub.urlPath(name)
+	return hub.settings.isHiddenPath(urlPath) || hub.ignore.ignored(urlPath, isDir)
+}
+
+func (hub *watchHub) run() {
+	defer close(hub.changed)
+	for {
+		select {
+		case event, ok := <-hub.watcher.Events:
+			if !ok {
+				return
+			}
+
+			stat, err := os.Stat(event.Name)
+			isDir := err == nil && stat.IsDir()
+			if hub.skip(event.Name, isDir) {
+				continue
+			}
+
+			if event.Has(fsnotify.Create) && isDir {
+				hub.add(event.Name)
+			}
+
+			hub.publish(fileEvent{Path: hub.urlPath(event.Name), Op: strings.ToLower(event.Op.String()), Time: time.Now()})
+		case err, ok := <-hub.watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Fprintln(errorLog, "Error watching files:", err)
+		}
+	}
+}
+
+func (hub *watchHub) publish(event fileEvent) {
+	hub.mu.Lock()
+	for ch := range hub.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+	hub.mu.Unlock()
+
+	select {
+	case hub.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (hub *watchHub) rebuild() {
+	for range hub.changed {
+		debounce := time.NewTimer(hub.debounce)
+	wait:
+		for {
+			select {
+			case <-hub.changed:
+				debounce.Reset(hub.debounce)
+			case <-debounce.C:
+				break wait
+			}
+		}
+
+		if hub.command != "" {
+			err := runCommand(hub.command, hub.settings.quiet)
+			select {
+			case <-hub.changed:
+			default:
+			}
+			if err != nil {
+				fmt.Fprintln(errorLog, "Error running -on-change command:", err)
+				continue
+			}
+		}
+
+		hub.mu.Lock()
+		for ch := range hub.reloaders {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+		hub.mu.Unlock()
+	}
+}
+
+func runCommand(command string, quiet bool) error {
+	if !quiet {
+		fmt.Fprintln(errorLog, "Running", command)
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (hub *watchHub) subscribe() chan fileEvent {
+	ch := make(chan fileEvent, 64)
+	hub.mu.Lock()
+	hub.subscribers[ch] = true
+	hub.mu.Unlock()
+	return ch
+}
+
+func (hub *watchHub) unsubscribe(ch chan fileEvent) {
+	hub.mu.Lock()
+	delete(hub.subscribers, ch)
+	hub.mu.Unlock()
+}
+
+func (hub *watchHub) serveLiveReload(ws *websocket.Conn) {
+	reload := make(chan struct{}, 1)
+	hub.mu.Lock()
+	hub.reloaders[reload] = true
+	hub.mu.Unlock()
+	defer func() {
+		hub.mu.Lock()
+		delete(hub.reloaders, reload)
+		hub.mu.Unlock()
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		var msg string
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+		close(closed)
+	}()
+
+	for {
+		select {
+		case <-reload:
+			if websocket.Message.Send(ws, "reload") != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (hub *watchHub) serveEvents(w http.ResponseWriter, r *http.Request) {
+	events := hub.subscribe()
+	defer hub.unsubscribe(events)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func injectLiveReload(data []byte) []byte {
+	if i := bytes.LastIndex(bytes.ToLower(data), []byte("</body>")); i >= 0 {
+		return append(data[:i:i], append([]byte(liveReloadScript), data[i:]...)...)
+	}
+	return append(data, liveReloadScript...)
+}
+
+type hijackResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w hijackResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func withLiveReload(h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hw := &htmlResponseWriter{ResponseWriter: w, r: r, transform: injectLiveReload}
+		h.ServeHTTP(hw, r)
+		hw.finish()
+	}
+}
+
+func withWatchEvents(hub *watchHub, h http.Handler) http.HandlerFunc {
+	ws := websocket.Server{Handler: hub.serveLiveReload}
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case liveReloadPath:
+			ws.ServeHTTP(hijackResponseWriter{w}, r)
+			return
+		case eventsPath:
+			hub.serveEvents(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
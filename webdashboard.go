@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"time"
+)
+
+var webDashboard = flag.Bool("dashboard", false, "Serve live traffic stats, the current settings and recent requests at /_dashboard (requires authentication)")
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+type dashboardData struct {
+	trafficSnapshot
+	Uptime   float64         `json:"uptime_seconds"`
+	Settings json.RawMessage `json:"settings"`
+}
+
+func withWebDashboard(root string, h http.Handler) http.HandlerFunc {
+	settings := bytes.Buffer{}
+	settingsErr := writeSettings(&settings, root)
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_dashboard":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write(dashboardHTML)
+		case "/_dashboard/stats":
+			if settingsErr != nil {
+				writeAPIError(w, http.StatusInternalServerError, "500 error reading settings")
+				return
+			}
+
+			snap := traffic.snapshot(10)
+			w.Header().Set("Cache-Control", "no-store")
+			writeAPIJSON(w, http.StatusOK, dashboardData{
+				trafficSnapshot: snap,
+				Uptime:          time.Since(snap.Started).Seconds(),
+				Settings:        settings.Bytes(),
+			})
+		default:
+			h.ServeHTTP(w, r)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+var (
+	webDAV      = flag.Bool("webdav", false, "Expose the root over WebDAV so it can be mounted read-only")
+	webDAVWrite = flag.Bool("webdav-write", false, "Allow WebDAV clients to create, modify and delete files (implies -webdav, requires authentication)")
+)
+
+var webDAVMethods = map[string]bool{
+	"OPTIONS":  true,
+	"PROPFIND": true,
+}
+
+var webDAVWriteMethods = map[string]bool{
+	"PUT":       true,
+	"DELETE":    true,
+	"MKCOL":     true,
+	"COPY":      true,
+	"MOVE":      true,
+	"PROPPATCH": true,
+	"LOCK":      true,
+	"UNLOCK":    true,
+}
+
+type webDAVFileSystem struct {
+	webdav.FileSystem
+	settings *settings
+	writable bool
+}
+
+func (fs webDAVFileSystem) check(name string, write bool) error {
+	if fs.settings.isHiddenPath(name) || (write && !fs.writable) {
+		return os.ErrPermission
+	}
+	return nil
+}
+
+func (fs webDAVFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if err := fs.check(name, true); err != nil {
+		return err
+	}
+	return fs.FileSystem.Mkdir(ctx, name, perm)
+}
+
+func (fs webDAVFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if err := fs.check(name, flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0); err != nil {
+		return nil, err
+	}
+	if flag&os.O_CREATE != 0 && !fs.settings.overwrite {
+		flag |= os.O_EXCL
+	}
+	file, err := fs.FileSystem.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return webDAVFile{file, fs.settings.hiddenFiles}, nil
+}
+
+func (fs webDAVFileSystem) RemoveAll(ctx context.Context, name string) error {
+	if err := fs.check(name, true); err != nil {
+		return err
+	}
+	return fs.FileSystem.RemoveAll(ctx, name)
+}
+
+func (fs webDAVFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	if err := fs.check(oldName, true); err != nil {
+		return err
+	}
+	if err := fs.check(newName, true); err != nil {
+		return err
+	}
+	return fs.FileSystem.Rename(ctx, oldName, newName)
+}
+
+func (fs webDAVFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if err := fs.check(name, false); err != nil {
+		return nil, err
+	}
+	return fs.FileSystem.Stat(ctx, name)
+}
+
+type webDAVFile struct {
+	webdav.File
+	showHidden bool
+}
+
+func (f webDAVFile) Readdir(count int) ([]os.FileInfo, error) {
+	files, err := f.File.Readdir(count)
+	if f.showHidden {
+		return files, err
+	}
+
+	filtered := []os.FileInfo{}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), ".") {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered, err
+}
+
+func withWebDAV(cfg *settings, writable bool, h http.Handler) http.HandlerFunc {
+	dav := &webdav.Handler{
+		FileSystem: webDAVFileSystem{webdav.Dir(cfg.root), cfg, writable},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !cfg.quiet {
+				fmt.Fprintln(errorLog, "WebDAV error:", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case webDAVMethods[r.Method]:
+			dav.ServeHTTP(w, r)
+		case webDAVWriteMethods[r.Method]:
+			if !writable {
+				if r.Method == http.MethodPut && cfg.upload {
+					h.ServeHTTP(w, r)
+					return
+				}
+				w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+				http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if !cfg.overwrite {
+				if r.Method == http.MethodPut {
+					if _, err := dav.FileSystem.Stat(r.Context(), r.URL.Path); err == nil {
+						http.Error(w, "409 file already exists", http.StatusConflict)
+						return
+					}
+				}
+				r = r.Clone(r.Context())
+				r.Header.Set("Overwrite", "F")
+			}
+			dav.ServeHTTP(w, r)
+		default:
+			h.ServeHTTP(w, r)
+		}
+	}
+}